@@ -0,0 +1,96 @@
+package fasthttpprom
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// accessLogEntry is a line of the access log
+type accessLogEntry struct {
+	Time     string  `json:"time"`
+	Method   string  `json:"method"`
+	Route    string  `json:"route"`
+	Path     string  `json:"path"`
+	Status   string  `json:"status"`
+	Duration float64 `json:"duration_seconds"`
+	Bytes    int     `json:"bytes"`
+	RemoteIP string  `json:"remote_ip"`
+}
+
+// WithAccessLog writes a JSON line for every recorded request to w, with the method,
+// route pattern, path label, status and duration the request is recorded with, so logs
+// and metrics agree on endpoint naming
+func WithAccessLog(w io.Writer) Option {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return func(p *Prometheus) {
+		p.accessLogs = append(p.accessLogs, func(ctx *fasthttp.RequestCtx, o Observation) {
+			entry := newAccessLogEntry(ctx, o)
+			mu.Lock()
+			err := enc.Encode(entry)
+			mu.Unlock()
+			if err != nil {
+				log.Printf("Fail to write access log: %s\n", err)
+			}
+		})
+	}
+}
+
+// WithAccessLogFunc logs every recorded request like WithAccessLog with log, which takes
+// a message and alternating keys and values, f.e slog.Logger's Info or
+// zap.SugaredLogger's Infow method values
+func WithAccessLogFunc(log func(msg string, keysAndValues ...interface{})) Option {
+	return func(p *Prometheus) {
+		p.accessLogs = append(p.accessLogs, func(ctx *fasthttp.RequestCtx, o Observation) {
+			e := newAccessLogEntry(ctx, o)
+			log("request",
+				"method", e.Method,
+				"route", e.Route,
+				"path", e.Path,
+				"status", e.Status,
+				"duration", o.Duration,
+				"bytes", e.Bytes,
+				"remote_ip", e.RemoteIP,
+			)
+		})
+	}
+}
+
+func newAccessLogEntry(ctx *fasthttp.RequestCtx, o Observation) accessLogEntry {
+	return accessLogEntry{
+		Time:     o.Start.UTC().Format(time.RFC3339Nano),
+		Method:   o.Method,
+		Route:    o.Route(),
+		Path:     o.Path,
+		Status:   o.Code,
+		Duration: o.Duration.Seconds(),
+		Bytes:    responseBytes(ctx),
+		RemoteIP: ctx.RemoteIP().String(),
+	}
+}
+
+// responseBytes returns the size of the response body. Streamed bodies are not read,
+// which would drain the stream before it is written, so their size is the
+// Content-Length set by the handler, or -1 when unknown.
+func responseBytes(ctx *fasthttp.RequestCtx) int {
+	if ctx.Response.IsBodyStream() {
+		if n := ctx.Response.Header.ContentLength(); n >= 0 {
+			return n
+		}
+		return -1
+	}
+
+	return len(ctx.Response.Body())
+}
+
+// logAccess hands the recorded observation of ctx to the access logs
+func (p *Prometheus) logAccess(ctx *fasthttp.RequestCtx, o Observation) {
+	for _, accessLog := range p.accessLogs {
+		accessLog(ctx, o)
+	}
+}
@@ -0,0 +1,43 @@
+package fasthttpprom
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+func TestAccessLogBytes(t *testing.T) {
+	r := router.New()
+	r.GET("/body", func(ctx *fasthttp.RequestCtx) { ctx.SetBodyString("hello") })
+	r.GET("/sized", func(ctx *fasthttp.RequestCtx) { ctx.SetBodyStream(strings.NewReader("hello"), 5) })
+	r.GET("/chunked", func(ctx *fasthttp.RequestCtx) { ctx.SetBodyStream(strings.NewReader("hello"), -1) })
+	var buf bytes.Buffer
+	p := newTestPrometheus(t, "test_access_log_bytes", r, WithAccessLog(&buf))
+
+	for uri, want := range map[string]int{"/body": 5, "/sized": 5, "/chunked": -1} {
+		buf.Reset()
+		ctx := serve(p.Handler, fasthttp.MethodGet, uri)
+		var entry accessLogEntry
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("access log of %s: %s", uri, err)
+		}
+		if entry.Bytes != want {
+			t.Errorf("bytes of %s = %d, want %d", uri, entry.Bytes, want)
+		}
+		// the stream is still written in full after the access log
+		var out bytes.Buffer
+		w := bufio.NewWriter(&out)
+		if err := ctx.Response.Write(w); err != nil {
+			t.Fatal(err)
+		}
+		w.Flush()
+		if !strings.Contains(out.String(), "hello") {
+			t.Errorf("response of %s lost its body: %q", uri, out.String())
+		}
+	}
+}
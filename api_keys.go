@@ -0,0 +1,168 @@
+package fasthttpprom
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// apiKeyCountersPerRank is the number of keys monitored per exported rank, more keep the
+// estimated counts of the top keys closer to their true counts
+const apiKeyCountersPerRank = 10
+
+// otherAPIKey is the key label of the requests of the keys outside the top k
+const otherAPIKey = "other"
+
+// WithTopAPIKeys counts the requests per API key returned by key, exporting the k keys
+// with the most requests in top_api_key_requests by key and the remaining requests with
+// key="other", so per-client usage is visible without unbounded label cardinality. The
+// counts are estimated with the space-saving algorithm, monitoring 10 times k keys.
+// key should return a client identifier rather than the secret itself, requests for
+// which it returns "" are not counted.
+func WithTopAPIKeys(k int, key func(ctx *fasthttp.RequestCtx) string) Option {
+	return func(p *Prometheus) {
+		p.apiKeys = &topAPIKeys{k: k, key: key, sketch: newSpaceSaving(k * apiKeyCountersPerRank)}
+	}
+}
+
+// topAPIKeys exports the top k of a space-saving sketch of the API keys
+type topAPIKeys struct {
+	k      int
+	key    func(ctx *fasthttp.RequestCtx) string
+	desc   *prometheus.Desc
+	sketch *spaceSaving
+}
+
+func (p *Prometheus) registerTopAPIKeys(subsystem string) {
+	p.apiKeys.desc = prometheus.NewDesc(
+		prometheus.BuildFQName("", subsystem, "top_api_key_requests"),
+		"estimated requests of the API keys with the most requests, and of the other keys",
+		[]string{"key"}, nil,
+	)
+	prometheus.Register(p.apiKeys)
+}
+
+// countAPIKey counts the request of ctx for its API key
+func (p *Prometheus) countAPIKey(ctx *fasthttp.RequestCtx) {
+	if key := p.apiKeys.key(ctx); key != "" {
+		p.apiKeys.sketch.add(sanitizeLabel(key))
+	}
+}
+
+// Describe implements prometheus.Collector
+func (t *topAPIKeys) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.desc
+}
+
+// Collect implements prometheus.Collector
+func (t *topAPIKeys) Collect(ch chan<- prometheus.Metric) {
+	top, total := t.sketch.top(t.k)
+	var counted uint64
+	for _, c := range top {
+		ch <- prometheus.MustNewConstMetric(t.desc, prometheus.GaugeValue, float64(c.count), c.key)
+		counted += c.count
+	}
+	if total > counted {
+		ch <- prometheus.MustNewConstMetric(t.desc, prometheus.GaugeValue, float64(total-counted), otherAPIKey)
+	}
+}
+
+// spaceSaving estimates the most frequent keys with a fixed number of counters. A key
+// which is not monitored replaces the key with the lowest count, inheriting it, so
+// counts are overestimated by at most the lowest count.
+type spaceSaving struct {
+	mu       sync.Mutex
+	capacity int
+	total    uint64
+	byKey    map[string]*keyCounter
+	counters keyCounterHeap
+}
+
+type keyCounter struct {
+	key   string
+	count uint64
+	index int
+}
+
+func newSpaceSaving(capacity int) *spaceSaving {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &spaceSaving{capacity: capacity, byKey: make(map[string]*keyCounter, capacity)}
+}
+
+// add counts a request of key
+func (s *spaceSaving) add(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.total++
+	if c, ok := s.byKey[key]; ok {
+		c.count++
+		heap.Fix(&s.counters, c.index)
+		return
+	}
+	if len(s.counters) < s.capacity {
+		c := &keyCounter{key: key, count: 1}
+		s.byKey[key] = c
+		heap.Push(&s.counters, c)
+		return
+	}
+	min := s.counters[0]
+	delete(s.byKey, min.key)
+	min.key = key
+	min.count++
+	s.byKey[key] = min
+	heap.Fix(&s.counters, 0)
+}
+
+// top returns the n keys with the highest counts, highest first, and the total count
+func (s *spaceSaving) top(n int) ([]keyCounter, uint64) {
+	s.mu.Lock()
+	counters := make([]keyCounter, 0, len(s.counters))
+	for _, c := range s.counters {
+		counters = append(counters, *c)
+	}
+	total := s.total
+	s.mu.Unlock()
+
+	sort.Slice(counters, func(i, j int) bool {
+		if counters[i].count != counters[j].count {
+			return counters[i].count > counters[j].count
+		}
+		return counters[i].key < counters[j].key
+	})
+	if len(counters) > n {
+		counters = counters[:n]
+	}
+
+	return counters, total
+}
+
+// keyCounterHeap is a min-heap of counters by count
+type keyCounterHeap []*keyCounter
+
+func (h keyCounterHeap) Len() int           { return len(h) }
+func (h keyCounterHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h keyCounterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *keyCounterHeap) Push(x interface{}) {
+	c := x.(*keyCounter)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+
+func (h *keyCounterHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,51 @@
+package fasthttpprom
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+func TestSpaceSaving(t *testing.T) {
+	s := newSpaceSaving(2)
+	for _, key := range []string{"a", "a", "a", "b", "c"} {
+		s.add(key)
+	}
+	// c replaced b, the key with the lowest count, inheriting its count
+	top, total := s.top(3)
+	want := []keyCounter{{key: "a", count: 3}, {key: "c", count: 2}}
+	for i := range top {
+		top[i].index = 0
+	}
+	if !reflect.DeepEqual(top, want) || total != 5 {
+		t.Errorf("top = %v, total %d, want %v, total 5", top, total, want)
+	}
+	if top, _ := s.top(1); len(top) != 1 || top[0].key != "a" {
+		t.Errorf("top(1) = %v, want a", top)
+	}
+}
+
+func TestTopAPIKeys(t *testing.T) {
+	r := router.New()
+	r.GET("/", func(ctx *fasthttp.RequestCtx) {})
+	key := func(ctx *fasthttp.RequestCtx) string { return string(ctx.Request.Header.Peek("X-Client")) }
+	p := newTestPrometheus(t, "test_top_api_keys", r, WithTopAPIKeys(1, key))
+
+	for _, client := range []string{"heavy", "heavy", "light", ""} {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.Header.SetMethod(fasthttp.MethodGet)
+		ctx.Request.SetRequestURI("/")
+		ctx.Request.Header.Set("X-Client", client)
+		p.Handler(ctx)
+	}
+	for client, want := range map[string]float64{"heavy": 2, otherAPIKey: 1} {
+		if v, _ := metricValue(t, "test_top_api_keys_top_api_key_requests", map[string]string{"key": client}); v != want {
+			t.Errorf("requests of %s = %v, want %v", client, v, want)
+		}
+	}
+	if _, ok := metricValue(t, "test_top_api_keys_top_api_key_requests", map[string]string{"key": "light"}); ok {
+		t.Error("key outside the top exported")
+	}
+}
@@ -0,0 +1,120 @@
+package fasthttpprom
+
+import (
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Observation is a single request measurement, labeled the same way as the
+// request_duration_seconds histogram
+type Observation struct {
+	Code     string
+	Method   string
+	Path     string
+	Start    time.Time
+	Duration time.Duration
+	// Exemplar holds the exemplar labels of the request, f.e its trace ID, or nil
+	Exemplar prometheus.Labels
+	// Labels holds the additional labels configured with options such as
+	// WithRegionLabel, or nil
+	Labels prometheus.Labels
+	// Tenant is the tenant resolved with WithTenants, or empty
+	Tenant string
+}
+
+// Route returns the path label without its method prefix, f.e "/health" for GET_/health
+func (o Observation) Route() string {
+	return strings.TrimPrefix(o.Path, o.Method+"_")
+}
+
+// MetricsBackend receives the request observations recorded by the middleware, so they
+// can be exported to sinks other than Prometheus
+type MetricsBackend interface {
+	Record(o Observation)
+}
+
+// DropReporter is implemented by backends recording observations asynchronously, which
+// lose them f.e when a write fails. The middleware sets the handler of the backends it
+// records to, counting the dropped observations in instrumentation_errors_total.
+type DropReporter interface {
+	SetDropHandler(fn func(n int))
+}
+
+// WithBackend records every observation to b in addition to the Prometheus histogram
+func WithBackend(b MetricsBackend) Option {
+	return func(p *Prometheus) {
+		p.backends = append(p.backends, b)
+	}
+}
+
+// WithOnlyBackend records observations to b instead of the Prometheus histogram. Further
+// backends can still be added with WithBackend.
+func WithOnlyBackend(b MetricsBackend) Option {
+	return func(p *Prometheus) {
+		p.skipPrometheus = true
+		p.backends = append(p.backends, b)
+	}
+}
+
+// record hands o to every configured backend
+func (p *Prometheus) record(o Observation) {
+	for _, b := range p.backends {
+		p.safeRecord(b, o)
+	}
+}
+
+// closeBackends closes the backends implementing io.Closer, which flush the
+// observations they buffer
+func (p *Prometheus) closeBackends() {
+	for _, b := range p.backends {
+		if c, ok := b.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Printf("Fail to close backend: %s\n", err)
+			}
+		}
+	}
+}
+
+// promBackend is the default backend, recording into the request_duration_seconds
+// histogram
+type promBackend struct {
+	p *Prometheus
+}
+
+func (b promBackend) Record(o Observation) {
+	if b.p.retired(o.Start) || b.p.tenants != nil && b.p.tenants.recorded(o) {
+		return
+	}
+	values := []string{o.Code, o.Path}
+	for _, source := range b.p.labelSources {
+		values = append(values, o.Labels[source.name])
+	}
+	ob, err := b.p.histogramOf(o.Method).GetMetricWithLabelValues(values...)
+	if err != nil {
+		b.p.instrumentationError(reasonLabelValues, err)
+		return
+	}
+	b.p.trackSeries(o.Start, values...)
+	if eo, ok := ob.(prometheus.ExemplarObserver); ok && o.Exemplar != nil {
+		b.observeWithExemplar(eo, o)
+		return
+	}
+	ob.Observe(o.Duration.Seconds())
+}
+
+// observeWithExemplar observes o with its exemplar, which the histogram rejects by
+// panicking, f.e when its labels are too long. The value is observed before the exemplar
+// is checked, so a rejected exemplar is only counted.
+func (b promBackend) observeWithExemplar(eo prometheus.ExemplarObserver, o Observation) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			b.p.instrumentationError(reasonExemplar, rcv)
+		}
+	}()
+
+	eo.ObserveWithExemplar(o.Duration.Seconds(), o.Exemplar)
+}
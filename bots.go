@@ -0,0 +1,86 @@
+package fasthttpprom
+
+import (
+	"bytes"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// classes of automated_requests_total
+const (
+	classProbe   = "probe"
+	classCrawler = "crawler"
+)
+
+// userAgentClass is a known automated client, matched by a User-Agent substring
+type userAgentClass struct {
+	agent string
+	class string
+	match []byte
+}
+
+// knownAgents are the health probes and crawlers counted in automated_requests_total
+var knownAgents = []userAgentClass{
+	{"kube-probe", classProbe, []byte("kube-probe/")},
+	{"elb-healthchecker", classProbe, []byte("ELB-HealthChecker/")},
+	{"google-hc", classProbe, []byte("GoogleHC/")},
+	{"consul", classProbe, []byte("Consul Health Check")},
+	{"googlebot", classCrawler, []byte("Googlebot")},
+	{"bingbot", classCrawler, []byte("bingbot")},
+	{"yandexbot", classCrawler, []byte("YandexBot")},
+	{"baiduspider", classCrawler, []byte("Baiduspider")},
+	{"duckduckbot", classCrawler, []byte("DuckDuckBot")},
+	{"applebot", classCrawler, []byte("Applebot")},
+	{"ahrefsbot", classCrawler, []byte("AhrefsBot")},
+	{"semrushbot", classCrawler, []byte("SemrushBot")},
+	{"facebook", classCrawler, []byte("facebookexternalhit")},
+}
+
+// WithBotClassifier counts the requests of health probes, f.e kube-probe and the ELB
+// health checker, and of common crawlers in automated_requests_total by class and agent.
+// With exclude they are not recorded in request_duration_seconds, so they don't skew
+// SLOs.
+func WithBotClassifier(exclude bool) Option {
+	return func(p *Prometheus) {
+		p.classifyBots = true
+		p.excludeBots = exclude
+	}
+}
+
+func (p *Prometheus) registerBotClassifier(subsystem string) {
+	p.automatedRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: subsystem,
+			Name:      "automated_requests_total",
+			Help:      "requests of health probes and crawlers by class and agent",
+		},
+		[]string{"class", "agent"},
+	)
+	prometheus.Register(p.automatedRequests)
+}
+
+// classifyAgent returns the known automated client sending userAgent, if any
+func classifyAgent(userAgent []byte) (userAgentClass, bool) {
+	for _, known := range knownAgents {
+		if bytes.Contains(userAgent, known.match) {
+			return known, true
+		}
+	}
+
+	return userAgentClass{}, false
+}
+
+// countBot counts the request of ctx if it is sent by a known automated client,
+// reporting whether it is to be excluded from the histogram
+func (p *Prometheus) countBot(ctx *fasthttp.RequestCtx) bool {
+	known, ok := classifyAgent(ctx.UserAgent())
+	if !ok {
+		return false
+	}
+	if p.recording() {
+		p.automatedRequests.WithLabelValues(known.class, known.agent).Inc()
+	}
+
+	return p.excludeBots
+}
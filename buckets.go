@@ -0,0 +1,94 @@
+package fasthttpprom
+
+import (
+	"log"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// bucketPresetEnv names the environment variable selecting a bucket preset by name,
+// overridden by WithBuckets and WithBucketPreset
+const bucketPresetEnv = "FASTHTTPPROM_BUCKETS"
+
+var (
+	// BucketsWebLatency suit user facing requests, from 5ms to 10s
+	BucketsWebLatency = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// BucketsAPIInternal suit service to service calls, from 1ms to 1s
+	BucketsAPIInternal = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}
+	// BucketsBatch suit long running requests, from 100ms to 10m
+	BucketsBatch = []float64{.1, .5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+)
+
+// bucketPresets are the presets by name
+var bucketPresets = map[string][]float64{
+	"default":      DefaultBuckets,
+	"web_latency":  BucketsWebLatency,
+	"api_internal": BucketsAPIInternal,
+	"batch":        BucketsBatch,
+}
+
+// BucketPreset returns the buckets of the preset name, one of "default", "web_latency",
+// "api_internal" and "batch", reporting whether it exists
+func BucketPreset(name string) ([]float64, bool) {
+	buckets, ok := bucketPresets[name]
+	return buckets, ok
+}
+
+// WithBuckets sets the request_duration_seconds histogram buckets, in seconds,
+// DefaultBuckets by default
+func WithBuckets(buckets []float64) Option {
+	return func(p *Prometheus) {
+		p.buckets = buckets
+	}
+}
+
+// WithExponentialBuckets sets the request_duration_seconds histogram buckets to count
+// buckets, the first with the upper bound start and every further one factor times
+// the previous one. Invalid arguments are logged and leave the buckets unchanged.
+func WithExponentialBuckets(start, factor float64, count int) Option {
+	return func(p *Prometheus) {
+		if count < 1 || start <= 0 || factor <= 1 {
+			log.Printf("Fail to set exponential buckets: invalid start %g, factor %g or count %d\n", start, factor, count)
+			return
+		}
+		p.buckets = prometheus.ExponentialBuckets(start, factor, count)
+	}
+}
+
+// WithLinearBuckets sets the request_duration_seconds histogram buckets to count
+// buckets, the first with the upper bound start and every further one width wider.
+// Invalid arguments are logged and leave the buckets unchanged.
+func WithLinearBuckets(start, width float64, count int) Option {
+	return func(p *Prometheus) {
+		if count < 1 || width <= 0 {
+			log.Printf("Fail to set linear buckets: invalid width %g or count %d\n", width, count)
+			return
+		}
+		p.buckets = prometheus.LinearBuckets(start, width, count)
+	}
+}
+
+// WithBucketPreset sets the request_duration_seconds histogram buckets to the preset
+// name, see BucketPreset. Unknown presets are logged and leave the buckets unchanged.
+func WithBucketPreset(name string) Option {
+	return func(p *Prometheus) {
+		p.setBucketPreset(name)
+	}
+}
+
+func (p *Prometheus) setBucketPreset(name string) {
+	buckets, ok := BucketPreset(name)
+	if !ok {
+		log.Printf("Fail to set buckets: unknown preset %q\n", name)
+		return
+	}
+	p.buckets = buckets
+}
+
+// envBuckets sets the buckets to the preset named by FASTHTTPPROM_BUCKETS, if set
+func (p *Prometheus) envBuckets() {
+	if name := os.Getenv(bucketPresetEnv); name != "" {
+		p.setBucketPreset(name)
+	}
+}
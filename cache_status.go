@@ -0,0 +1,35 @@
+package fasthttpprom
+
+import (
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// cacheStatuses are the values of the cache label, other statuses are recorded as "other"
+var cacheStatuses = map[string]bool{
+	"hit":         true,
+	"miss":        true,
+	"bypass":      true,
+	"expired":     true,
+	"stale":       true,
+	"updating":    true,
+	"revalidated": true,
+}
+
+// WithCacheStatusLabel adds a cache label to request_duration_seconds with the lower
+// cased value of the response header set by the caching layer, f.e X-Cache: HIT, so cache
+// effectiveness per route is visible. Values other than hit, miss, bypass, expired,
+// stale, updating and revalidated are recorded as "other", responses without the header
+// as "unknown".
+func WithCacheStatusLabel(header string) Option {
+	return func(p *Prometheus) {
+		p.labelSources = append(p.labelSources, labelSource{
+			name: "cache",
+			extract: func(ctx *fasthttp.RequestCtx) string {
+				return boundedLabel(strings.ToLower(string(ctx.Response.Header.Peek(header))), cacheStatuses)
+			},
+			values: len(cacheStatuses) + 2,
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package fasthttpprom
+
+import "sync"
+
+// overflowPath is the path label value used once the path cardinality cap is reached
+const overflowPath = "overflow"
+
+// pathGuard admits at most max distinct path label values
+type pathGuard struct {
+	mu    sync.RWMutex
+	max   int
+	paths map[string]struct{}
+}
+
+func newPathGuard(max int) *pathGuard {
+	return &pathGuard{
+		max:   max,
+		paths: make(map[string]struct{}),
+	}
+}
+
+// admit reports whether path may be used as a label value, remembering it if there is
+// room left under the cap
+func (g *pathGuard) admit(path string) bool {
+	g.mu.RLock()
+	_, ok := g.paths[path]
+	g.mu.RUnlock()
+	if ok {
+		return true
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.paths[path]; ok {
+		return true
+	}
+	if len(g.paths) >= g.max {
+		return false
+	}
+	g.paths[path] = struct{}{}
+
+	return true
+}
+
+// release frees the slot held by path
+func (g *pathGuard) release(path string) {
+	g.mu.Lock()
+	delete(g.paths, path)
+	g.mu.Unlock()
+}
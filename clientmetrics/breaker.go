@@ -0,0 +1,58 @@
+package clientmetrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// BreakerState is the state of a circuit breaker, exported as the value of
+// circuit_breaker_state
+type BreakerState int
+
+// Circuit breaker states
+const (
+	BreakerClosed BreakerState = iota
+	BreakerHalfOpen
+	BreakerOpen
+)
+
+// BreakerObserver receives the state transitions of the circuit breakers guarding
+// upstreams. Circuit breaker libraries report into it from their state change callbacks.
+type BreakerObserver interface {
+	OnStateChange(upstream string, from, to BreakerState)
+}
+
+// BreakerMetrics is a BreakerObserver exporting the breaker state per upstream and the
+// number of times each breaker opened
+type BreakerMetrics struct {
+	state *prometheus.GaugeVec
+	trips *prometheus.CounterVec
+}
+
+// NewBreakerMetrics registers circuit_breaker_state and circuit_breaker_trips_total with
+// the upstream label under subsystem
+func NewBreakerMetrics(subsystem string) *BreakerMetrics {
+	return &BreakerMetrics{
+		state: register(prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Subsystem: subsystem,
+				Name:      "circuit_breaker_state",
+				Help:      "circuit breaker state, 0 closed, 1 half-open, 2 open",
+			},
+			[]string{"upstream"},
+		)).(*prometheus.GaugeVec),
+		trips: register(prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Subsystem: subsystem,
+				Name:      "circuit_breaker_trips_total",
+				Help:      "circuit breaker transitions to open",
+			},
+			[]string{"upstream"},
+		)).(*prometheus.CounterVec),
+	}
+}
+
+// OnStateChange records the transition of the breaker guarding upstream
+func (m *BreakerMetrics) OnStateChange(upstream string, from, to BreakerState) {
+	m.state.WithLabelValues(upstream).Set(float64(to))
+	if to == BreakerOpen && from != BreakerOpen {
+		m.trips.WithLabelValues(upstream).Inc()
+	}
+}
@@ -0,0 +1,111 @@
+// Package clientmetrics instruments outbound requests made with fasthttp clients, so both
+// sides of a service are covered by the same metrics library.
+//
+//	c := clientmetrics.New(&fasthttp.Client{}, "")
+//	err := c.DoTimeout(req, resp, time.Second)
+package clientmetrics
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	fasthttpprom "github.com/carousell/fasthttp-prometheus-middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// errorCode is the code label of requests which failed without a response
+const errorCode = "error"
+
+// Client wraps a fasthttp.Client, recording the duration of every request
+type Client struct {
+	*fasthttp.Client
+	subsystem string
+	reqDur    *prometheus.HistogramVec
+	retry     *retrier
+}
+
+// New wraps c, registering client_request_duration_seconds with the host and code labels
+// under subsystem. Requests failing without a response are recorded with code="error".
+func New(c *fasthttp.Client, subsystem string) *Client {
+	reqDur := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: subsystem,
+			Name:      "client_request_duration_seconds",
+			Help:      "outbound request latencies",
+			Buckets:   fasthttpprom.DefaultBuckets,
+		},
+		[]string{"host", "code"},
+	)
+
+	return &Client{
+		Client:    c,
+		subsystem: subsystem,
+		reqDur:    register(reqDur).(*prometheus.HistogramVec),
+	}
+}
+
+// Do calls fasthttp.Client.Do and records the request
+func (c *Client) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	return c.do(req, resp, time.Time{}, func() error {
+		return c.Client.Do(req, resp)
+	})
+}
+
+// DoTimeout calls fasthttp.Client.DoTimeout and records the request. Retries share the
+// timeout.
+func (c *Client) DoTimeout(req *fasthttp.Request, resp *fasthttp.Response, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	return c.do(req, resp, deadline, func() error {
+		return c.Client.DoDeadline(req, resp, deadline)
+	})
+}
+
+// DoDeadline calls fasthttp.Client.DoDeadline and records the request
+func (c *Client) DoDeadline(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error {
+	return c.do(req, resp, deadline, func() error {
+		return c.Client.DoDeadline(req, resp, deadline)
+	})
+}
+
+// do records every attempt of the request, retrying it according to the retry policy
+func (c *Client) do(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time, attempt func() error) error {
+	for n := 1; ; n++ {
+		start := time.Now()
+		err := attempt()
+		c.observe(req, resp, err, time.Since(start))
+		if c.retry == nil || c.retry.MaxAttempts <= 1 || !c.retry.RetryIf(req, resp, err) {
+			return err
+		}
+		backoff := c.retry.Backoff(n)
+		if n >= c.retry.MaxAttempts || !deadline.IsZero() && time.Now().Add(backoff).After(deadline) {
+			c.retry.exhausted.WithLabelValues(string(req.Host())).Inc()
+			return err
+		}
+		c.retry.retries.WithLabelValues(string(req.Host())).Inc()
+		c.retry.backoffDur.WithLabelValues(string(req.Host())).Observe(backoff.Seconds())
+		time.Sleep(backoff)
+	}
+}
+
+func (c *Client) observe(req *fasthttp.Request, resp *fasthttp.Response, err error, d time.Duration) {
+	code := errorCode
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode())
+	}
+	c.reqDur.WithLabelValues(string(req.Host()), code).Observe(d.Seconds())
+}
+
+// register registers c, returning the already registered collector when an identical one
+// exists so several wrapped clients share their metrics
+func register(c prometheus.Collector) prometheus.Collector {
+	if err := prometheus.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			return are.ExistingCollector
+		}
+	}
+
+	return c
+}
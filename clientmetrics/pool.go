@@ -0,0 +1,186 @@
+package clientmetrics
+
+import (
+	"container/list"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// poolMetrics are shared by every instrumented HostClient of a subsystem
+type poolMetrics struct {
+	pending     *prometheus.GaugeVec
+	connsOpen   *prometheus.GaugeVec
+	acquireWait *prometheus.HistogramVec
+}
+
+func newPoolMetrics(subsystem string) *poolMetrics {
+	return &poolMetrics{
+		pending: register(prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Subsystem: subsystem,
+				Name:      "client_pending_requests",
+				Help:      "outbound requests in flight per host",
+			},
+			[]string{"host"},
+		)).(*prometheus.GaugeVec),
+		connsOpen: register(prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Subsystem: subsystem,
+				Name:      "client_connections_open",
+				Help:      "open connections of the client pool per host",
+			},
+			[]string{"host"},
+		)).(*prometheus.GaugeVec),
+		acquireWait: register(prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Subsystem: subsystem,
+				Name:      "client_conn_acquire_wait_seconds",
+				Help:      "time requests waited for a free connection of a saturated pool",
+				Buckets:   prometheus.ExponentialBuckets(.0005, 2, 14),
+			},
+			[]string{"host"},
+		)).(*prometheus.HistogramVec),
+	}
+}
+
+// HostClient wraps a fasthttp.HostClient, exporting the usage of its connection pool.
+// It implements fasthttp.BalancingClient, so it can be used within an LBClient.
+type HostClient struct {
+	*fasthttp.HostClient
+	pending     prometheus.Gauge
+	connsOpen   prometheus.Gauge
+	acquireWait prometheus.Observer
+
+	mu       sync.Mutex
+	maxConns int
+	inflight int
+	waiters  list.List
+}
+
+// NewHostClient wraps hc, registering client_pending_requests, client_connections_open and
+// client_conn_acquire_wait_seconds labeled with hc.Addr under subsystem. hc.Dial is
+// wrapped to count the open connections, so it must be set before calling NewHostClient.
+//
+// fasthttp does not expose connection acquisition, so the acquire wait is derived from
+// the requests in flight: a request started while all MaxConns connections are busy waits
+// until an earlier request completes, assuming the default FIFO pool strategy.
+func NewHostClient(hc *fasthttp.HostClient, subsystem string) *HostClient {
+	return newHostClient(hc, newPoolMetrics(subsystem))
+}
+
+func newHostClient(hc *fasthttp.HostClient, m *poolMetrics) *HostClient {
+	maxConns := hc.MaxConns
+	if maxConns <= 0 {
+		maxConns = fasthttp.DefaultMaxConnsPerHost
+	}
+	c := &HostClient{
+		HostClient:  hc,
+		pending:     m.pending.WithLabelValues(hc.Addr),
+		connsOpen:   m.connsOpen.WithLabelValues(hc.Addr),
+		acquireWait: m.acquireWait.WithLabelValues(hc.Addr),
+		maxConns:    maxConns,
+	}
+	dial := hc.Dial
+	if dial == nil {
+		dial = fasthttp.Dial
+		if hc.DialDualStack {
+			dial = fasthttp.DialDualStack
+		}
+	}
+	hc.Dial = func(addr string) (net.Conn, error) {
+		conn, err := dial(addr)
+		if err != nil {
+			return nil, err
+		}
+		c.connsOpen.Inc()
+		return &countedConn{Conn: conn, open: c.connsOpen}, nil
+	}
+
+	return c
+}
+
+// InstrumentLBClient replaces every *fasthttp.HostClient balanced by lb with an
+// instrumented HostClient. Call it before lb is used.
+func InstrumentLBClient(lb *fasthttp.LBClient, subsystem string) {
+	m := newPoolMetrics(subsystem)
+	for i, bc := range lb.Clients {
+		if hc, ok := bc.(*fasthttp.HostClient); ok {
+			lb.Clients[i] = newHostClient(hc, m)
+		}
+	}
+}
+
+// Do calls fasthttp.HostClient.Do and records the pool usage
+func (c *HostClient) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	defer c.acquire()()
+	return c.HostClient.Do(req, resp)
+}
+
+// DoTimeout calls fasthttp.HostClient.DoTimeout and records the pool usage
+func (c *HostClient) DoTimeout(req *fasthttp.Request, resp *fasthttp.Response, timeout time.Duration) error {
+	defer c.acquire()()
+	return c.HostClient.DoTimeout(req, resp, timeout)
+}
+
+// DoDeadline calls fasthttp.HostClient.DoDeadline and records the pool usage
+func (c *HostClient) DoDeadline(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error {
+	defer c.acquire()()
+	return c.HostClient.DoDeadline(req, resp, deadline)
+}
+
+// waiter is a request started while every connection of the pool was busy
+type waiter struct {
+	start  time.Time
+	served bool
+}
+
+// acquire accounts a request entering the pool, queueing it as a waiter when all
+// connections are busy. The returned func accounts it leaving.
+func (c *HostClient) acquire() func() {
+	c.pending.Inc()
+
+	c.mu.Lock()
+	var w *waiter
+	var el *list.Element
+	if c.inflight >= c.maxConns {
+		w = &waiter{start: time.Now()}
+		el = c.waiters.PushBack(w)
+	}
+	c.inflight++
+	c.mu.Unlock()
+
+	return func() {
+		c.pending.Dec()
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.inflight--
+		if w != nil && !w.served {
+			// gave up, f.e on ErrNoFreeConns, before a connection was freed
+			c.waiters.Remove(el)
+			return
+		}
+		// the connection released now is handed to the longest waiting request
+		if front := c.waiters.Front(); front != nil {
+			next := c.waiters.Remove(front).(*waiter)
+			next.served = true
+			c.acquireWait.Observe(time.Since(next.start).Seconds())
+		}
+	}
+}
+
+// countedConn decrements the open connections gauge once closed
+type countedConn struct {
+	net.Conn
+	open      prometheus.Gauge
+	closeOnce sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.closeOnce.Do(c.open.Dec)
+	return c.Conn.Close()
+}
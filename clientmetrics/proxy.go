@@ -0,0 +1,61 @@
+package clientmetrics
+
+import (
+	"strconv"
+	"time"
+
+	fasthttpprom "github.com/carousell/fasthttp-prometheus-middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// Doer sends a request, f.e fasthttp.Client, HostClient or LBClient
+type Doer interface {
+	Do(req *fasthttp.Request, resp *fasthttp.Response) error
+}
+
+// Proxy records the upstream latency of reverse proxied requests, separately from the
+// total latency recorded by the middleware, so slowness can be attributed to backends
+type Proxy struct {
+	upstreamDur *prometheus.HistogramVec
+}
+
+// NewProxy registers proxy_upstream_duration_seconds with the upstream and code labels
+// under subsystem
+func NewProxy(subsystem string) *Proxy {
+	return &Proxy{
+		upstreamDur: register(prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Subsystem: subsystem,
+				Name:      "proxy_upstream_duration_seconds",
+				Help:      "latencies of requests forwarded to upstreams",
+				Buckets:   fasthttpprom.DefaultBuckets,
+			},
+			[]string{"upstream", "code"},
+		)).(*prometheus.HistogramVec),
+	}
+}
+
+// Do forwards req to upstream through c and records the upstream latency. Requests
+// failing without a response are recorded with code="error".
+func (p *Proxy) Do(upstream string, c Doer, req *fasthttp.Request, resp *fasthttp.Response) error {
+	start := time.Now()
+	err := c.Do(req, resp)
+	code := errorCode
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode())
+	}
+	p.upstreamDur.WithLabelValues(upstream, code).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+// Handler forwards every request to upstream through c, answering 502 Bad Gateway when
+// the upstream cannot be reached
+func (p *Proxy) Handler(upstream string, c Doer) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if err := p.Do(upstream, c, &ctx.Request, &ctx.Response); err != nil {
+			ctx.Error(fasthttp.StatusMessage(fasthttp.StatusBadGateway), fasthttp.StatusBadGateway)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package clientmetrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+var defaultRetryBackoff = 100 * time.Millisecond
+
+// maxRetryBackoff caps the default backoff, which doubles with every attempt
+var maxRetryBackoff = 10 * time.Second
+
+// RetryPolicy configures the retries made by a Client
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one. Requests are not
+	// retried when it is 0 or 1.
+	MaxAttempts int
+	// Backoff returns the sleep before retrying after the n-th attempt. It defaults to
+	// 100ms doubling with every attempt, up to 10s.
+	Backoff func(n int) time.Duration
+	// RetryIf reports whether the attempt should be retried. By default idempotent
+	// requests which failed or were answered with 502, 503 or 504 are retried.
+	RetryIf func(req *fasthttp.Request, resp *fasthttp.Response, err error) bool
+}
+
+// retrier is a RetryPolicy with its metrics
+type retrier struct {
+	RetryPolicy
+	retries    *prometheus.CounterVec
+	exhausted  *prometheus.CounterVec
+	backoffDur *prometheus.HistogramVec
+}
+
+// SetRetryPolicy makes the client retry requests according to policy, counting retries in
+// client_retries_total, requests still failing after the last attempt in
+// client_retries_exhausted_total and the backoff sleeps in client_retry_backoff_seconds,
+// all labeled by host
+func (c *Client) SetRetryPolicy(policy RetryPolicy) {
+	if policy.Backoff == nil {
+		policy.Backoff = defaultBackoff
+	}
+	if policy.RetryIf == nil {
+		policy.RetryIf = defaultRetryIf
+	}
+	c.retry = &retrier{
+		RetryPolicy: policy,
+		retries: register(prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Subsystem: c.subsystem,
+				Name:      "client_retries_total",
+				Help:      "outbound request retries",
+			},
+			[]string{"host"},
+		)).(*prometheus.CounterVec),
+		exhausted: register(prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Subsystem: c.subsystem,
+				Name:      "client_retries_exhausted_total",
+				Help:      "outbound requests which failed after their last retry",
+			},
+			[]string{"host"},
+		)).(*prometheus.CounterVec),
+		backoffDur: register(prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Subsystem: c.subsystem,
+				Name:      "client_retry_backoff_seconds",
+				Help:      "sleeps before retrying outbound requests",
+				Buckets:   prometheus.ExponentialBuckets(.01, 2, 10),
+			},
+			[]string{"host"},
+		)).(*prometheus.HistogramVec),
+	}
+}
+
+// defaultBackoff doubles defaultRetryBackoff with every attempt up to maxRetryBackoff,
+// without overflowing the shift on long retry policies
+func defaultBackoff(n int) time.Duration {
+	backoff := defaultRetryBackoff
+	for i := 1; i < n && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+
+	return backoff
+}
+
+func defaultRetryIf(req *fasthttp.Request, resp *fasthttp.Response, err error) bool {
+	if !isIdempotent(&req.Header) {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode() {
+	case fasthttp.StatusBadGateway, fasthttp.StatusServiceUnavailable, fasthttp.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// isIdempotent reports whether the request can be sent again without side effects
+func isIdempotent(h *fasthttp.RequestHeader) bool {
+	return h.IsGet() || h.IsHead() || h.IsPut() || h.IsDelete() || h.IsOptions() || h.IsTrace()
+}
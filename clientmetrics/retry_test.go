@@ -0,0 +1,83 @@
+package clientmetrics
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+// unavailableClient returns a client of a server answering every request with 503, and
+// the number of requests the server received
+func unavailableClient(t *testing.T, subsystem string, policy RetryPolicy) (*Client, *atomic.Int64) {
+	t.Helper()
+	ln := fasthttputil.NewInmemoryListener()
+	attempts := &atomic.Int64{}
+	go fasthttp.Serve(ln, func(ctx *fasthttp.RequestCtx) {
+		attempts.Add(1)
+		ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+	})
+	t.Cleanup(func() { ln.Close() })
+
+	c := New(&fasthttp.Client{Dial: func(string) (net.Conn, error) { return ln.Dial() }}, subsystem)
+	policy.Backoff = func(int) time.Duration { return 0 }
+	c.SetRetryPolicy(policy)
+
+	return c, attempts
+}
+
+func TestRetryPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		method      string
+		maxAttempts int
+		want        int64
+	}{
+		{"get", fasthttp.MethodGet, 3, 3},
+		{"post", fasthttp.MethodPost, 3, 1},
+		{"no_retries", fasthttp.MethodGet, 0, 1},
+		{"single_attempt", fasthttp.MethodGet, 1, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, attempts := unavailableClient(t, "test_retry_"+tc.name, RetryPolicy{MaxAttempts: tc.maxAttempts})
+			req := fasthttp.AcquireRequest()
+			resp := fasthttp.AcquireResponse()
+			defer fasthttp.ReleaseRequest(req)
+			defer fasthttp.ReleaseResponse(resp)
+			req.Header.SetMethod(tc.method)
+			req.SetRequestURI("http://backend/")
+
+			if err := c.Do(req, resp); err != nil {
+				t.Fatal(err)
+			}
+			if got := attempts.Load(); got != tc.want {
+				t.Errorf("attempts = %d, want %d", got, tc.want)
+			}
+			exhausted := 0.0
+			if tc.want > 1 {
+				exhausted = 1
+			}
+			if got := counterValue(t, c.retry.exhausted.WithLabelValues("backend")); got != exhausted {
+				t.Errorf("exhausted = %v, want %v", got, exhausted)
+			}
+		})
+	}
+}
+
+func TestDefaultBackoff(t *testing.T) {
+	for n, want := range map[int]time.Duration{
+		1:    100 * time.Millisecond,
+		2:    200 * time.Millisecond,
+		4:    800 * time.Millisecond,
+		8:    maxRetryBackoff,
+		70:   maxRetryBackoff,
+		1000: maxRetryBackoff,
+	} {
+		if got := defaultBackoff(n); got != want {
+			t.Errorf("defaultBackoff(%d) = %s, want %s", n, got, want)
+		}
+	}
+}
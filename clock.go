@@ -0,0 +1,61 @@
+package fasthttpprom
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// clock is the time source used to measure request durations
+type clock interface {
+	Now() time.Time
+	Stop()
+}
+
+// systemClock reads time.Now on every call
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) Stop() {}
+
+// coarseClock keeps the elapsed time since its creation in an atomic which is refreshed
+// by a ticker, so Now is a single atomic load. The returned times are derived from base
+// and therefore keep its monotonic reading.
+type coarseClock struct {
+	base     time.Time
+	elapsed  atomic.Int64
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newCoarseClock(resolution time.Duration) *coarseClock {
+	c := &coarseClock{
+		base: time.Now(),
+		done: make(chan struct{}),
+	}
+	go c.run(resolution)
+
+	return c
+}
+
+func (c *coarseClock) run(resolution time.Duration) {
+	ticker := time.NewTicker(resolution)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.elapsed.Store(int64(time.Since(c.base)))
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *coarseClock) Now() time.Time {
+	return c.base.Add(time.Duration(c.elapsed.Load()))
+}
+
+func (c *coarseClock) Stop() {
+	c.stopOnce.Do(func() { close(c.done) })
+}
@@ -0,0 +1,69 @@
+package fasthttpprom
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// uncompressedKey is the user value holding the body size before compression
+const uncompressedKey = "fasthttpprom.uncompressed"
+
+// CompressHandler wraps h with compress, f.e fasthttp.CompressHandler which is used when
+// compress is nil, recording the body sizes of the responses it compresses by path in
+// compression_uncompressed_bytes_total, compression_compressed_bytes_total and the
+// compression_ratio histogram of compressed to uncompressed size
+func (p *Prometheus) CompressHandler(h fasthttp.RequestHandler, compress func(fasthttp.RequestHandler) fasthttp.RequestHandler) fasthttp.RequestHandler {
+	if compress == nil {
+		compress = fasthttp.CompressHandler
+	}
+	uncompressed := registerCollector(prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: p.subsystem,
+			Name:      "compression_uncompressed_bytes_total",
+			Help:      "sizes of compressed response bodies before compression",
+		},
+		[]string{"path"},
+	)).(*prometheus.CounterVec)
+	compressed := registerCollector(prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: p.subsystem,
+			Name:      "compression_compressed_bytes_total",
+			Help:      "sizes of compressed response bodies after compression",
+		},
+		[]string{"path"},
+	)).(*prometheus.CounterVec)
+	ratio := registerCollector(prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: p.subsystem,
+			Name:      "compression_ratio",
+			Help:      "ratios of compressed to uncompressed response body size",
+			Buckets:   prometheus.LinearBuckets(.1, .1, 10),
+		},
+		[]string{"path"},
+	)).(*prometheus.HistogramVec)
+
+	handler := compress(func(ctx *fasthttp.RequestCtx) {
+		h(ctx)
+		if len(ctx.Response.Header.ContentEncoding()) == 0 && !ctx.Response.IsBodyStream() {
+			ctx.SetUserValue(uncompressedKey, len(ctx.Response.Body()))
+		}
+	})
+
+	return func(ctx *fasthttp.RequestCtx) {
+		handler(ctx)
+		before, ok := ctx.UserValue(uncompressedKey).(int)
+		if !ok || before == 0 || len(ctx.Response.Header.ContentEncoding()) == 0 {
+			return
+		}
+		after := len(ctx.Response.Body())
+		ep := p.requestLabel(ctx, strconv.Itoa(ctx.Response.StatusCode()))
+		if ep == "" {
+			return
+		}
+		uncompressed.WithLabelValues(ep).Add(float64(before))
+		compressed.WithLabelValues(ep).Add(float64(after))
+		ratio.WithLabelValues(ep).Observe(float64(after) / float64(before))
+	}
+}
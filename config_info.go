@@ -0,0 +1,104 @@
+package fasthttpprom
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// registerConfigInfo exports config_info, labeled with a hash of the active
+// configuration and a summary of its buckets, labels and filters, so configuration
+// drift across a fleet can be detected with count by (hash) (config_info)
+func (p *Prometheus) registerConfigInfo(subsystem string) {
+	config := p.configSummary()
+	h := fnv.New64a()
+	for _, key := range sortedKeys(config) {
+		fmt.Fprintf(h, "%s=%s\n", key, config[key])
+	}
+
+	info := prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Subsystem: subsystem,
+			Name:      "config_info",
+			Help:      "active configuration of the middleware",
+			ConstLabels: prometheus.Labels{
+				"hash":       strconv.FormatUint(h.Sum64(), 16),
+				"buckets":    config["buckets"],
+				"labels":     config["labels"],
+				"skip_codes": config["skip_codes"],
+				"fallback":   config["fallback"],
+			},
+		},
+	)
+	info.Set(1)
+	prometheus.Register(info)
+}
+
+// configSummary describes the configuration affecting what is recorded. Options taking
+// functions are only described by whether they are set.
+func (p *Prometheus) configSummary() map[string]string {
+	buckets := make([]string, 0, len(p.buckets))
+	for _, b := range p.buckets {
+		buckets = append(buckets, formatFloat(b))
+	}
+	methods := make([]string, 0, len(p.methodBuckets))
+	for method, bs := range p.methodBuckets {
+		b := make([]string, 0, len(bs))
+		for _, bound := range bs {
+			b = append(b, formatFloat(bound))
+		}
+		methods = append(methods, method+":"+strings.Join(b, ","))
+	}
+	sort.Strings(methods)
+	codes := make([]string, 0, len(p.skipCodes))
+	for code := range p.skipCodes {
+		codes = append(codes, strconv.Itoa(code))
+	}
+	sort.Strings(codes)
+	fallback := "path"
+	switch p.fallback {
+	case FallbackUnknown:
+		fallback = "unknown"
+	case FallbackDrop:
+		fallback = "drop"
+	}
+
+	return map[string]string{
+		"buckets":          strings.Join(buckets, ","),
+		"method_buckets":   strings.Join(methods, ";"),
+		"labels":           strings.Join(p.labelNames(), ","),
+		"skip_codes":       strings.Join(codes, ","),
+		"fallback":         fallback,
+		"max_series":       strconv.Itoa(p.maxSeries),
+		"series_ttl":       p.seriesTTL.String(),
+		"max_duration":     p.maxDuration.String(),
+		"warmup":           p.warmup.String() + "/" + strconv.Itoa(int(p.warmupMode)),
+		"max_paths":        strconv.Itoa(p.maxPaths),
+		"max_label_length": strconv.Itoa(p.maxLabelLength),
+		"normalizer":       strconv.FormatBool(p.normalizer != nil),
+		"hijack_mode":      strconv.Itoa(int(p.hijackMode)),
+		"redirect_mode":    strconv.Itoa(int(p.redirectMode)),
+		"unset_status":     strconv.FormatBool(p.markUnsetStatus),
+		"metrics_matcher":  strconv.FormatBool(p.metricsMatcher != nil),
+		"status_mapper":    strconv.FormatBool(p.statusMapper != nil),
+		"relabels":         strconv.Itoa(len(p.relabels)),
+		"exemplars":        strconv.Itoa(len(p.exemplars)),
+		"exemplar_sampler": strconv.FormatBool(p.exemplarSampler != nil),
+		"dry_run":          strconv.FormatBool(p.dryRun != nil),
+		"bots":             strconv.FormatBool(p.classifyBots) + "/" + strconv.FormatBool(p.excludeBots),
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
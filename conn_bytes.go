@@ -0,0 +1,111 @@
+package fasthttpprom
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ConnBytes accumulates the bytes read from and written to wrapped connections into
+// process-wide counters
+type ConnBytes struct {
+	read    prometheus.Counter
+	written prometheus.Counter
+	size    prometheus.Histogram
+}
+
+// NewConnBytes registers connection_read_bytes_total and connection_written_bytes_total
+// under subsystem. With sizeHistogram, the total bytes transferred by every connection is
+// recorded in connection_size_bytes when it is closed.
+func NewConnBytes(subsystem string, sizeHistogram bool) *ConnBytes {
+	b := &ConnBytes{
+		read: registerCollector(prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Subsystem: subsystem,
+				Name:      "connection_read_bytes_total",
+				Help:      "bytes read from connections",
+			},
+		)).(prometheus.Counter),
+		written: registerCollector(prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Subsystem: subsystem,
+				Name:      "connection_written_bytes_total",
+				Help:      "bytes written to connections",
+			},
+		)).(prometheus.Counter),
+	}
+	if sizeHistogram {
+		b.size = registerCollector(prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Subsystem: subsystem,
+				Name:      "connection_size_bytes",
+				Help:      "bytes read and written by closed connections",
+				Buckets:   prometheus.ExponentialBuckets(256, 4, 10),
+			},
+		)).(prometheus.Histogram)
+	}
+
+	return b
+}
+
+// Conn wraps c, counting the bytes read and written through it. Wrap the raw connection
+// below TLS to count the bytes on the wire.
+func (b *ConnBytes) Conn(c net.Conn) net.Conn {
+	return &countingConn{Conn: c, b: b}
+}
+
+// Listener wraps ln so every accepted connection is counted
+func (b *ConnBytes) Listener(ln net.Listener) net.Listener {
+	return &countingListener{Listener: ln, b: b}
+}
+
+type countingListener struct {
+	net.Listener
+	b *ConnBytes
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return l.b.Conn(c), nil
+}
+
+type countingConn struct {
+	net.Conn
+	b         *ConnBytes
+	total     atomic.Int64
+	closeOnce sync.Once
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.b.read.Add(float64(n))
+		c.total.Add(int64(n))
+	}
+
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.b.written.Add(float64(n))
+		c.total.Add(int64(n))
+	}
+
+	return n, err
+}
+
+func (c *countingConn) Close() error {
+	if c.b.size != nil {
+		c.closeOnce.Do(func() { c.b.size.Observe(float64(c.total.Load())) })
+	}
+
+	return c.Conn.Close()
+}
@@ -0,0 +1,42 @@
+package fasthttpprom
+
+import (
+	"os"
+
+	"github.com/valyala/fasthttp"
+)
+
+// deploymentEnv names the environment variable holding the initial deployment label value
+const deploymentEnv = "FASTHTTPPROM_DEPLOYMENT"
+
+// WithDeploymentLabel labels every request with the deployment it was served by, f.e
+// deployment="blue" or canary="true", for traffic shift analysis during rollouts. The
+// label is named name and valued value, or the FASTHTTPPROM_DEPLOYMENT environment
+// variable when value is empty, until SetDeployment switches it.
+func WithDeploymentLabel(name, value string) Option {
+	return func(p *Prometheus) {
+		if value == "" {
+			value = os.Getenv(deploymentEnv)
+		}
+		p.SetDeployment(value)
+		p.labelSources = append(p.labelSources, labelSource{
+			name: name,
+			extract: func(ctx *fasthttp.RequestCtx) string {
+				return *p.deployment.Load()
+			},
+			// a rollout switches between two deployments
+			values: 2,
+		})
+	}
+}
+
+// SetDeployment switches the value of the deployment label, "unknown" if empty. Requests
+// are recorded in the series with the new value from now on, the series of the previous
+// value keep their counts.
+func (p *Prometheus) SetDeployment(value string) {
+	if value == "" {
+		value = "unknown"
+	}
+	value = sanitizeLabel(value)
+	p.deployment.Store(&value)
+}
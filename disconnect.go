@@ -0,0 +1,39 @@
+package fasthttpprom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// WithDisconnectMetrics counts the requests whose client went away before the response
+// was written in client_disconnects_total by path, like nginx's 499
+func WithDisconnectMetrics() Option {
+	return func(p *Prometheus) {
+		p.disconnectMetrics = true
+	}
+}
+
+func (p *Prometheus) registerDisconnectMetrics(subsystem string) {
+	p.clientDisconnects = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: subsystem,
+			Name:      "client_disconnects_total",
+			Help:      "requests whose client went away before the response was written, like nginx's 499",
+		},
+		[]string{"path"},
+	)
+	prometheus.Register(p.clientDisconnects)
+}
+
+// trackDisconnect counts the request of ctx in client_disconnects_total if writing its
+// response fails. fasthttp writes the response after the handler returns, so only the
+// connections accepted by a Listener, whose writes can be observed, are tracked.
+func (p *Prometheus) trackDisconnect(ctx *fasthttp.RequestCtx, ep string) {
+	conn := listenerConnOf(ctx.Conn())
+	if conn == nil || !p.disconnectMetrics || !p.recording() {
+		return
+	}
+	conn.notifyWriteError(func() {
+		p.clientDisconnects.WithLabelValues(ep).Inc()
+	})
+}
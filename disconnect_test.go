@@ -0,0 +1,45 @@
+package fasthttpprom
+
+import (
+	"bufio"
+	"errors"
+	"testing"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+// failingWriter fails every write like a connection closed by the client
+type failingWriter struct{}
+
+func (failingWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestDisconnectMetrics(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"enabled":  {WithDisconnectMetrics()},
+		"disabled": nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := router.New()
+			var p *Prometheus
+			r.GET("/events", func(ctx *fasthttp.RequestCtx) {
+				p.SetBodyStreamWriter(ctx, func(w *bufio.Writer) { w.WriteString("event") })
+			})
+			subsystem := "test_disconnect_metrics_" + name
+			p = newTestPrometheus(t, subsystem, r, opts...)
+
+			ctx := serve(p.Handler, fasthttp.MethodGet, "/events")
+			ctx.Response.Write(bufio.NewWriterSize(failingWriter{}, 16))
+
+			disconnects := gatheredLabels(t, subsystem+"_client_disconnects_total")
+			if opts == nil && len(disconnects) > 0 {
+				t.Errorf("client_disconnects_total exported without WithDisconnectMetrics")
+			}
+			if v, _ := metricValue(t, subsystem+"_client_disconnects_total", map[string]string{"path": "GET_/events"}); opts != nil && v != 1 {
+				t.Errorf("client_disconnects_total = %v, want 1", v)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package fasthttpprom
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// MetricsEndpoint is the address of the metrics server started by SetListenAddress
+type MetricsEndpoint struct {
+	// Host is empty when listening on all interfaces
+	Host string
+	Port int
+	Path string
+}
+
+// Registrar registers the metrics endpoint with a service discovery system, so scrapers
+// discover instances without static configuration
+type Registrar interface {
+	Register(e MetricsEndpoint) error
+	Deregister(e MetricsEndpoint) error
+}
+
+// WithRegistrar registers the metrics server started by SetListenAddress with r once it
+// starts and deregisters it when Close is called
+func WithRegistrar(r Registrar) Option {
+	return func(p *Prometheus) {
+		p.registrar = r
+	}
+}
+
+// registerDiscovery registers the metrics endpoint with the configured registrar. The
+// port is the one the listener is bound to, so ports chosen by the system and service
+// names are resolved, the host the configured one.
+func (p *Prometheus) registerDiscovery() {
+	host, _, err := net.SplitHostPort(p.listenAddress)
+	if err != nil {
+		log.Printf("Fail to register metrics endpoint: %s\n", err)
+		return
+	}
+	addr, ok := p.metricsListener.Addr().(*net.TCPAddr)
+	if !ok {
+		log.Printf("Fail to register metrics endpoint: no TCP address for %s\n", p.metricsListener.Addr())
+		return
+	}
+	e := MetricsEndpoint{Host: host, Port: addr.Port, Path: p.MetricsPath}
+	if err := p.registrar.Register(e); err != nil {
+		log.Printf("Fail to register metrics endpoint: %s\n", err)
+		return
+	}
+	p.runEvery(0, 0, nil, func() {
+		if err := p.registrar.Deregister(e); err != nil {
+			log.Printf("Fail to deregister metrics endpoint: %s\n", err)
+		}
+	})
+}
+
+var defaultConsulAddr = "http://127.0.0.1:8500"
+
+var defaultConsulTimeout = 10 * time.Second
+
+// ConsulConfig configures registering the metrics endpoint as a Consul service
+type ConsulConfig struct {
+	// Addr of the Consul agent, http://127.0.0.1:8500 if empty
+	Addr string
+	// Token is the ACL token, if any
+	Token string
+	// Service is the service name
+	Service string
+	// ID is the service ID, Service if empty
+	ID string
+	// Tags of the service
+	Tags []string
+	// CheckInterval adds an HTTP check of the metrics path run at this interval
+	CheckInterval time.Duration
+}
+
+// ConsulRegistrar registers the metrics endpoint with a Consul agent through its HTTP API
+type ConsulRegistrar struct {
+	cfg    ConsulConfig
+	client *fasthttp.Client
+}
+
+// NewConsulRegistrar returns a Registrar for the Consul agent configured by cfg
+func NewConsulRegistrar(cfg ConsulConfig) *ConsulRegistrar {
+	if cfg.Addr == "" {
+		cfg.Addr = defaultConsulAddr
+	}
+	if cfg.ID == "" {
+		cfg.ID = cfg.Service
+	}
+
+	return &ConsulRegistrar{cfg: cfg, client: &fasthttp.Client{}}
+}
+
+type consulCheck struct {
+	HTTP                           string
+	Interval                       string
+	DeregisterCriticalServiceAfter string
+}
+
+type consulService struct {
+	ID      string
+	Name    string
+	Tags    []string          `json:",omitempty"`
+	Address string            `json:",omitempty"`
+	Port    int               `json:",omitempty"`
+	Meta    map[string]string `json:",omitempty"`
+	Check   *consulCheck      `json:",omitempty"`
+}
+
+// Register implements Registrar
+func (c *ConsulRegistrar) Register(e MetricsEndpoint) error {
+	service := consulService{
+		ID:      c.cfg.ID,
+		Name:    c.cfg.Service,
+		Tags:    c.cfg.Tags,
+		Address: e.Host,
+		Port:    e.Port,
+		Meta:    map[string]string{"metrics_path": e.Path},
+	}
+	if c.cfg.CheckInterval > 0 {
+		host := e.Host
+		if host == "" {
+			host = "127.0.0.1"
+		}
+		service.Check = &consulCheck{
+			HTTP:                           "http://" + net.JoinHostPort(host, strconv.Itoa(e.Port)) + e.Path,
+			Interval:                       c.cfg.CheckInterval.String(),
+			DeregisterCriticalServiceAfter: (10 * c.cfg.CheckInterval).String(),
+		}
+	}
+	body, err := json.Marshal(service)
+	if err != nil {
+		return err
+	}
+
+	return c.put("/v1/agent/service/register", body)
+}
+
+// Deregister implements Registrar
+func (c *ConsulRegistrar) Deregister(MetricsEndpoint) error {
+	return c.put("/v1/agent/service/deregister/"+c.cfg.ID, nil)
+}
+
+func (c *ConsulRegistrar) put(path string, body []byte) error {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.SetRequestURI(c.cfg.Addr + path)
+	req.Header.SetMethod(fasthttp.MethodPut)
+	if c.cfg.Token != "" {
+		req.Header.Set("X-Consul-Token", c.cfg.Token)
+	}
+	req.SetBody(body)
+
+	if err := c.client.DoTimeout(req, resp, defaultConsulTimeout); err != nil {
+		return err
+	}
+	if code := resp.StatusCode(); code != fasthttp.StatusOK {
+		return fmt.Errorf("consul: unexpected status code %d", code)
+	}
+
+	return nil
+}
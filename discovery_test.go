@@ -0,0 +1,48 @@
+package fasthttpprom
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/fasthttp/router"
+)
+
+// fakeRegistrar keeps the registered endpoints
+type fakeRegistrar struct {
+	mu        sync.Mutex
+	endpoints []MetricsEndpoint
+}
+
+func (r *fakeRegistrar) Register(e MetricsEndpoint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.endpoints = append(r.endpoints, e)
+	return nil
+}
+
+func (r *fakeRegistrar) Deregister(e MetricsEndpoint) error {
+	return nil
+}
+
+func TestRegisterDiscoveryBoundPort(t *testing.T) {
+	registrar := &fakeRegistrar{}
+	p := NewPrometheus("test_discovery_bound_port", WithRegistrar(registrar))
+	defer p.Close()
+	p.SetListenAddress("127.0.0.1:0")
+	if err := p.Custom(router.New()); err != nil {
+		t.Fatal(err)
+	}
+	defer p.metricsServer.Shutdown()
+
+	_, port, _ := net.SplitHostPort(p.metricsListener.Addr().String())
+	registrar.mu.Lock()
+	defer registrar.mu.Unlock()
+	if len(registrar.endpoints) != 1 {
+		t.Fatalf("%d endpoints registered, want 1", len(registrar.endpoints))
+	}
+	if e := registrar.endpoints[0]; e.Host != "127.0.0.1" || strconv.Itoa(e.Port) != port || e.Port == 0 {
+		t.Errorf("registered %+v, want 127.0.0.1:%s", e, port)
+	}
+}
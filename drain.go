@@ -0,0 +1,56 @@
+package fasthttpprom
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// drainPollInterval is the interval Drain checks the in-flight requests at
+const drainPollInterval = 10 * time.Millisecond
+
+func (p *Prometheus) registerInFlight(subsystem string) {
+	p.draining = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Subsystem: subsystem,
+			Name:      "draining",
+			Help:      "whether the application is draining in-flight requests for shutdown",
+		},
+	)
+	prometheus.Register(p.draining)
+	prometheus.Register(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Subsystem: subsystem,
+			Name:      "requests_in_flight",
+			Help:      "requests currently handled",
+		},
+		func() float64 { return float64(p.InFlight()) },
+	))
+}
+
+// InFlight returns the number of requests currently handled by the middleware
+func (p *Prometheus) InFlight() int64 {
+	return p.inFlight.Load()
+}
+
+// Drain sets draining to 1 and waits up to timeout for the in-flight requests to
+// complete, f.e after stopping to accept connections with fasthttp.Server.Shutdown, so
+// drains can be watched in requests_in_flight. It returns an error when requests are
+// still in flight after timeout.
+func (p *Prometheus) Drain(timeout time.Duration) error {
+	p.draining.Set(1)
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		n := p.InFlight()
+		if n == 0 {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("fasthttpprom: %d requests still in flight after %s", n, timeout)
+		}
+		<-ticker.C
+	}
+}
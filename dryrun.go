@@ -0,0 +1,64 @@
+package fasthttpprom
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WithDryRun resolves the labels of every request as usual but records nothing, neither
+// in the histograms nor in the request or route cache counters, handing the
+// observations to logf instead if it is not nil. The cap of WithMaxPathLabels is not
+// applied. The number of distinct label combinations seen is exported in
+// dry_run_series, so label cardinality and overhead can be validated in staging before
+// recording for real. Meant for staging only, since every combination is kept in memory.
+func WithDryRun(logf func(o Observation)) Option {
+	return func(p *Prometheus) {
+		p.dryRun = &dryRunBackend{logf: logf, seen: make(map[string]struct{})}
+	}
+}
+
+// recording reports whether the metrics of the middleware are recorded, which WithDryRun
+// turns off
+func (p *Prometheus) recording() bool {
+	return p.dryRun == nil
+}
+
+// dryRunBackend counts the distinct label combinations of the observations
+type dryRunBackend struct {
+	logf   func(o Observation)
+	series prometheus.Gauge
+	mu     sync.Mutex
+	seen   map[string]struct{}
+}
+
+func (p *Prometheus) registerDryRun(subsystem string) {
+	p.dryRun.series = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Subsystem: subsystem,
+			Name:      "dry_run_series",
+			Help:      "distinct label combinations request_duration_seconds would have",
+		},
+	)
+	prometheus.Register(p.dryRun.series)
+}
+
+func (b *dryRunBackend) Record(o Observation) {
+	key := make([]string, 0, 2+len(o.Labels))
+	key = append(key, o.Code, o.Path)
+	for name, value := range o.Labels {
+		key = append(key, name+"="+value)
+	}
+	// the extra labels come in map order
+	sort.Strings(key[2:])
+	b.mu.Lock()
+	b.seen[strings.Join(key, "\xff")] = struct{}{}
+	n := len(b.seen)
+	b.mu.Unlock()
+	b.series.Set(float64(n))
+	if b.logf != nil {
+		b.logf(o)
+	}
+}
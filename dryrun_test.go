@@ -0,0 +1,63 @@
+package fasthttpprom
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+func TestDryRunCountsNothing(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		subsystem := "test_recording"
+		var logged []Observation
+		opts := []Option{
+			WithSkipStatusCodes(fasthttp.StatusNotFound),
+			WithBotClassifier(false),
+			WithHandlerErrors(),
+			WithRedirectMode(RedirectSeparate),
+			WithTopAPIKeys(5, func(ctx *fasthttp.RequestCtx) string { return "key" }),
+			WithMaxPathLabels(1),
+			WithRouteCache(16),
+		}
+		if dryRun {
+			subsystem = "test_dry_run"
+			opts = append(opts, WithDryRun(func(o Observation) { logged = append(logged, o) }))
+		}
+		r := router.New()
+		r.GET("/missing", func(ctx *fasthttp.RequestCtx) { ctx.SetStatusCode(fasthttp.StatusNotFound) })
+		r.GET("/failing", func(ctx *fasthttp.RequestCtx) { SetError(ctx, errors.New("failed")) })
+		r.GET("/moved", func(ctx *fasthttp.RequestCtx) { ctx.Redirect("/failing", fasthttp.StatusMovedPermanently) })
+		p := newTestPrometheus(t, subsystem, r, opts...)
+
+		serve(p.Handler, fasthttp.MethodGet, "/missing")
+		serve(p.Handler, fasthttp.MethodGet, "/failing")
+		serve(p.Handler, fasthttp.MethodGet, "/moved")
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI("/failing")
+		ctx.Request.Header.SetUserAgent("kube-probe/1.27")
+		p.Handler(ctx)
+
+		for _, name := range []string{
+			"skipped_requests_total", "handler_errors_total", "automated_requests_total",
+			"redirect_duration_seconds", "top_api_key_requests", "request_duration_seconds",
+			"label_overflow_total", "route_cache_lookups_total",
+		} {
+			total := 0.0
+			for _, labels := range gatheredLabels(t, subsystem+"_"+name) {
+				v, _ := metricValue(t, subsystem+"_"+name, labels)
+				total += v
+			}
+			if dryRun && total != 0 {
+				t.Errorf("%s = %v in dry-run", name, total)
+			}
+			if !dryRun && total == 0 {
+				t.Errorf("%s not recorded", name)
+			}
+		}
+		if dryRun && len(logged) != 2 {
+			t.Errorf("%d observations handed to logf, want 2", len(logged))
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package fasthttpprom
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultMaxDuration is the longest duration recorded unless WithMaxDuration changes it
+const defaultMaxDuration = time.Hour
+
+// reasons of anomalous_durations_total
+const (
+	// reasonNegative counts durations below zero, clamped to zero
+	reasonNegative = "negative"
+	// reasonZero counts durations of zero measured with the system clock
+	reasonZero = "zero"
+	// reasonTooLarge counts durations above the maximum, clamped to it
+	reasonTooLarge = "too_large"
+)
+
+// WithMaxDuration clamps the recorded durations to max, 1h by default, counting the
+// clamped ones in anomalous_durations_total, so clock jumps and hijacked connections do
+// not pollute the histogram tail
+func WithMaxDuration(max time.Duration) Option {
+	return func(p *Prometheus) {
+		p.maxDuration = max
+	}
+}
+
+func (p *Prometheus) registerDurationGuard(subsystem string) {
+	p.anomalousDurations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: subsystem,
+			Name:      "anomalous_durations_total",
+			Help:      "measured request durations which were zero, negative or above the maximum by reason",
+		},
+		[]string{"reason"},
+	)
+	for _, reason := range []string{reasonNegative, reasonZero, reasonTooLarge} {
+		p.anomalousDurations.WithLabelValues(reason)
+	}
+	prometheus.Register(p.anomalousDurations)
+}
+
+// guardDuration returns d clamped to the range of plausible durations, counting
+// anomalous ones. Zero durations are only anomalous with the system clock, the coarse
+// clock measures fast requests as zero.
+func (p *Prometheus) guardDuration(d time.Duration) time.Duration {
+	switch {
+	case d < 0:
+		p.countAnomaly(reasonNegative)
+		return 0
+	case d == 0:
+		if _, ok := p.clock.(systemClock); ok {
+			p.countAnomaly(reasonZero)
+		}
+	case p.maxDuration > 0 && d > p.maxDuration:
+		p.countAnomaly(reasonTooLarge)
+		return p.maxDuration
+	}
+
+	return d
+}
+
+// countAnomaly counts a duration which was anomalous for reason
+func (p *Prometheus) countAnomaly(reason string) {
+	if p.recording() {
+		p.anomalousDurations.WithLabelValues(reason).Inc()
+	}
+}
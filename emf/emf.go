@@ -0,0 +1,283 @@
+// Package emf emits the middleware's request metrics in the CloudWatch Embedded Metric
+// Format, so serverless and ECS services get per-route latency and counts from their logs
+// without a scrape infrastructure.
+//
+// Every flush writes one JSON document per method, and per path and code when enabled
+// as dimensions, f.e
+//
+//	{"_aws":{"Timestamp":1672531200000,"CloudWatchMetrics":[{"Namespace":"api","Dimensions":[["Method","Path","Code"]],"Metrics":[{"Name":"RequestDuration","Unit":"Milliseconds"},{"Name":"Requests","Unit":"Count"}]}]},"Method":"GET","Path":"/health","Code":"200","RequestDuration":[1.2,0.8],"Requests":2}
+package emf
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	fasthttpprom "github.com/carousell/fasthttp-prometheus-middleware"
+)
+
+var defaultFlushInterval = 10 * time.Second
+
+// maxValues is the largest number of values CloudWatch accepts for a metric in a document
+const maxValues = 100
+
+// Config configures an EMF backend
+type Config struct {
+	// Namespace of the CloudWatch metrics
+	Namespace string
+	// Writer receives the newline terminated JSON documents, os.Stdout if nil. A
+	// CloudWatch Logs client can be plugged in by implementing io.Writer.
+	Writer io.Writer
+	// FlushInterval between writes, 10s if zero
+	FlushInterval time.Duration
+	// ErrorHandler is called with every failed write. Errors are logged when it is nil.
+	ErrorHandler func(error)
+	// PathDimension adds the route as the Path dimension. CloudWatch bills every
+	// combination of dimension values as a separate metric, so it is off by default.
+	PathDimension bool
+	// CodeDimension adds the status code as the Code dimension, off by default
+	CodeDimension bool
+}
+
+type seriesKey struct {
+	method, path, code string
+}
+
+// Backend collects request durations and writes them as EMF documents
+type Backend struct {
+	cfg Config
+
+	mu     sync.Mutex
+	series map[seriesKey][]float64
+	// full holds the series which reached maxValues until the flush loop writes them
+	full []fullSeries
+	wake chan struct{}
+
+	writeMu sync.Mutex
+	onDrop  atomic.Pointer[func(n int)]
+
+	done     chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+type fullSeries struct {
+	key    seriesKey
+	values []float64
+}
+
+type document struct {
+	AWS             metadata  `json:"_aws"`
+	Method          string    `json:"Method"`
+	Path            string    `json:"Path,omitempty"`
+	Code            string    `json:"Code,omitempty"`
+	RequestDuration []float64 `json:"RequestDuration"`
+	Requests        int       `json:"Requests"`
+}
+
+type metadata struct {
+	Timestamp         int64             `json:"Timestamp"`
+	CloudWatchMetrics []metricDirective `json:"CloudWatchMetrics"`
+}
+
+type metricDirective struct {
+	Namespace  string         `json:"Namespace"`
+	Dimensions [][]string     `json:"Dimensions"`
+	Metrics    []metricDefine `json:"Metrics"`
+}
+
+type metricDefine struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+// New creates a backend writing to cfg.Writer every cfg.FlushInterval
+func New(cfg Config) *Backend {
+	if cfg.Writer == nil {
+		cfg.Writer = os.Stdout
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	b := &Backend{
+		cfg:    cfg,
+		series: make(map[seriesKey][]float64),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	b.wg.Add(1)
+	go b.run()
+
+	return b
+}
+
+// Record implements fasthttpprom.MetricsBackend. Series reaching the values CloudWatch
+// accepts in a document are written by the flush loop, never on the request path.
+func (b *Backend) Record(o fasthttpprom.Observation) {
+	key := seriesKey{method: o.Method}
+	if b.cfg.PathDimension {
+		key.path = o.Route()
+	}
+	if b.cfg.CodeDimension {
+		key.code = o.Code
+	}
+	ms := float64(o.Duration) / float64(time.Millisecond)
+
+	b.mu.Lock()
+	values := append(b.series[key], ms)
+	if len(values) < maxValues {
+		b.series[key] = values
+		b.mu.Unlock()
+		return
+	}
+	delete(b.series, key)
+	b.full = append(b.full, fullSeries{key, values})
+	b.mu.Unlock()
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Flush writes the durations collected since the previous flush. Documents failing to be
+// written are dropped, the first error is returned.
+func (b *Backend) Flush() error {
+	err := b.writeFull()
+
+	b.mu.Lock()
+	series := b.series
+	b.series = make(map[seriesKey][]float64, len(series))
+	b.mu.Unlock()
+
+	now := time.Now()
+	for key, values := range series {
+		if werr := b.writeValues(key, values, now); err == nil {
+			err = werr
+		}
+	}
+
+	return err
+}
+
+// writeFull writes the series which reached maxValues since the previous flush
+func (b *Backend) writeFull() error {
+	b.mu.Lock()
+	full := b.full
+	b.full = nil
+	b.mu.Unlock()
+
+	now := time.Now()
+	var err error
+	for _, s := range full {
+		if werr := b.writeValues(s.key, s.values, now); err == nil {
+			err = werr
+		}
+	}
+
+	return err
+}
+
+// writeValues writes values, reporting them as dropped when the write fails
+func (b *Backend) writeValues(key seriesKey, values []float64, now time.Time) error {
+	err := b.write(key, values, now)
+	if err != nil {
+		if fn := b.onDrop.Load(); fn != nil {
+			(*fn)(len(values))
+		}
+	}
+
+	return err
+}
+
+// SetDropHandler implements fasthttpprom.DropReporter, fn is called with the number of
+// durations lost by failed writes
+func (b *Backend) SetDropHandler(fn func(n int)) {
+	b.onDrop.Store(&fn)
+}
+
+// Close stops the flush loop and writes the remaining durations
+func (b *Backend) Close() error {
+	b.stopOnce.Do(func() { close(b.done) })
+	b.wg.Wait()
+
+	return b.Flush()
+}
+
+func (b *Backend) run() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.Flush(); err != nil {
+				b.handleError(err)
+			}
+		case <-b.wake:
+			if err := b.writeFull(); err != nil {
+				b.handleError(err)
+			}
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *Backend) write(key seriesKey, values []float64, now time.Time) error {
+	doc := document{
+		AWS: metadata{
+			Timestamp: now.UnixMilli(),
+			CloudWatchMetrics: []metricDirective{{
+				Namespace:  b.cfg.Namespace,
+				Dimensions: [][]string{b.dimensions()},
+				Metrics: []metricDefine{
+					{Name: "RequestDuration", Unit: "Milliseconds"},
+					{Name: "Requests", Unit: "Count"},
+				},
+			}},
+		},
+		Method:          key.method,
+		Path:            key.path,
+		Code:            key.code,
+		RequestDuration: values,
+		Requests:        len(values),
+	}
+	line, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	_, err = b.cfg.Writer.Write(line)
+
+	return err
+}
+
+func (b *Backend) handleError(err error) {
+	if b.cfg.ErrorHandler != nil {
+		b.cfg.ErrorHandler(err)
+		return
+	}
+	log.Printf("Fail to write EMF metrics: %s\n", err)
+}
+
+// dimensions returns the dimension names of the documents
+func (b *Backend) dimensions() []string {
+	dimensions := []string{"Method"}
+	if b.cfg.PathDimension {
+		dimensions = append(dimensions, "Path")
+	}
+	if b.cfg.CodeDimension {
+		dimensions = append(dimensions, "Code")
+	}
+
+	return dimensions
+}
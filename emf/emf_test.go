@@ -0,0 +1,114 @@
+package emf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	fasthttpprom "github.com/carousell/fasthttp-prometheus-middleware"
+)
+
+// syncBuffer is a bytes.Buffer safe for the flush loop and the test
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Lines() [][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return bytes.Split(bytes.TrimSpace(b.buf.Bytes()), []byte{'\n'})
+}
+
+func TestDimensions(t *testing.T) {
+	for _, tc := range []struct {
+		cfg  Config
+		want []string
+	}{
+		{Config{}, []string{"Method"}},
+		{Config{PathDimension: true}, []string{"Method", "Path"}},
+		{Config{PathDimension: true, CodeDimension: true}, []string{"Method", "Path", "Code"}},
+	} {
+		var out syncBuffer
+		tc.cfg.Writer = &out
+		tc.cfg.FlushInterval = time.Hour
+		b := New(tc.cfg)
+		b.Record(fasthttpprom.Observation{Method: "GET", Path: "GET_/a", Code: "200", Duration: time.Millisecond})
+		b.Record(fasthttpprom.Observation{Method: "GET", Path: "GET_/b", Code: "500", Duration: time.Millisecond})
+		if err := b.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		lines := out.Lines()
+		var doc document
+		if err := json.Unmarshal(lines[0], &doc); err != nil {
+			t.Fatal(err)
+		}
+		got := doc.AWS.CloudWatchMetrics[0].Dimensions[0]
+		if len(got) != len(tc.want) {
+			t.Fatalf("dimensions = %v, want %v", got, tc.want)
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Fatalf("dimensions = %v, want %v", got, tc.want)
+			}
+		}
+		if !tc.cfg.PathDimension && (len(lines) != 1 || doc.Requests != 2) {
+			t.Errorf("got %d documents with %d requests, want the requests aggregated by method", len(lines), doc.Requests)
+		}
+	}
+}
+
+func TestFullSeriesWrittenInBackground(t *testing.T) {
+	var out syncBuffer
+	b := New(Config{Writer: &out, FlushInterval: time.Hour})
+	defer b.Close()
+
+	for i := 0; i < maxValues; i++ {
+		b.Record(fasthttpprom.Observation{Method: "GET", Code: "200", Duration: time.Millisecond})
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(out.Lines()[0]) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("full series not written by the flush loop")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	var doc document
+	if err := json.Unmarshal(out.Lines()[0], &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Requests != maxValues {
+		t.Errorf("requests = %d, want %d", doc.Requests, maxValues)
+	}
+}
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("closed") }
+
+func TestDroppedOnFailedWrite(t *testing.T) {
+	b := New(Config{Writer: failingWriter{}, FlushInterval: time.Hour, PathDimension: true})
+	dropped := 0
+	b.SetDropHandler(func(n int) { dropped += n })
+	b.Record(fasthttpprom.Observation{Method: "GET", Path: "GET_/a", Duration: time.Millisecond})
+	b.Record(fasthttpprom.Observation{Method: "GET", Path: "GET_/a", Duration: time.Millisecond})
+	b.Record(fasthttpprom.Observation{Method: "GET", Path: "GET_/b", Duration: time.Millisecond})
+
+	if err := b.Close(); err == nil {
+		t.Fatal("no error for failed writes")
+	}
+	if dropped != 3 {
+		t.Errorf("dropped = %d, want 3", dropped)
+	}
+}
@@ -0,0 +1,70 @@
+package fasthttpprom
+
+import (
+	"errors"
+	"net"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// ErrorHandler returns a fasthttp.Server ErrorHandler counting the requests fasthttp
+// fails to read or parse in request_errors_total by reason, traffic which never reaches
+// the router. The response is written by next, or the same way as fasthttp's default
+// error handler when next is nil.
+//
+//	s := &fasthttp.Server{Handler: p.Handler, ErrorHandler: p.ErrorHandler(nil)}
+func (p *Prometheus) ErrorHandler(next func(ctx *fasthttp.RequestCtx, err error)) func(ctx *fasthttp.RequestCtx, err error) {
+	if next == nil {
+		next = defaultErrorHandler
+	}
+	requestErrors := registerCollector(prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: p.subsystem,
+			Name:      "request_errors_total",
+			Help:      "requests fasthttp failed to read or parse by reason",
+		},
+		[]string{"reason"},
+	)).(*prometheus.CounterVec)
+
+	return func(ctx *fasthttp.RequestCtx, err error) {
+		requestErrors.WithLabelValues(requestErrorReason(err)).Inc()
+		next(ctx, err)
+	}
+}
+
+// requestErrorReason returns the reason label of err, returned by fasthttp while reading
+// a request
+func requestErrorReason(err error) string {
+	var smallBuffer *fasthttp.ErrSmallBuffer
+	var brokenChunk fasthttp.ErrBrokenChunk
+	var netErr net.Error
+	switch {
+	case errors.As(err, &smallBuffer):
+		return "header_too_large"
+	case errors.Is(err, fasthttp.ErrBodyTooLarge):
+		return "body_too_large"
+	case errors.Is(err, fasthttp.ErrGetOnly):
+		return "get_only"
+	case errors.As(err, &brokenChunk):
+		return "broken_chunks"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	}
+
+	return "parse"
+}
+
+// defaultErrorHandler answers like fasthttp does without an ErrorHandler
+func defaultErrorHandler(ctx *fasthttp.RequestCtx, err error) {
+	var smallBuffer *fasthttp.ErrSmallBuffer
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &smallBuffer):
+		ctx.Error("Too big request header", fasthttp.StatusRequestHeaderFieldsTooLarge)
+	case errors.As(err, &opErr) && opErr.Timeout():
+		ctx.Error("Request timeout", fasthttp.StatusRequestTimeout)
+	default:
+		ctx.Error("Error when parsing request", fasthttp.StatusBadRequest)
+	}
+}
@@ -0,0 +1,88 @@
+package fasthttpprom
+
+import (
+	"bytes"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// ExemplarExtractor returns the exemplar labels to attach to the observation of a request,
+// or nil when the request has none
+type ExemplarExtractor func(ctx *fasthttp.RequestCtx) prometheus.Labels
+
+// WithExemplars attaches exemplars to the request_duration_seconds observations. The
+// extractors are tried in order and the first non-nil labels are used. Exemplars are
+// exposed when the metrics are scraped in the OpenMetrics format.
+func WithExemplars(extractors ...ExemplarExtractor) Option {
+	return func(p *Prometheus) {
+		p.exemplars = append(p.exemplars, extractors...)
+	}
+}
+
+// ExemplarSampler reports whether the exemplar of a request which took dur is attached
+type ExemplarSampler func(ctx *fasthttp.RequestCtx, dur time.Duration) bool
+
+// WithExemplarSampler attaches the exemplars of only the requests sample selects, since
+// extracting and storing one for every observation is heavy
+func WithExemplarSampler(sample ExemplarSampler) Option {
+	return func(p *Prometheus) {
+		p.exemplarSampler = sample
+	}
+}
+
+// EveryNthExemplar samples the exemplar of every nth request
+func EveryNthExemplar(n int) ExemplarSampler {
+	var count atomic.Uint64
+	return func(*fasthttp.RequestCtx, time.Duration) bool {
+		return n <= 1 || count.Add(1)%uint64(n) == 0
+	}
+}
+
+// SlowerThanExemplar samples the exemplars of requests which took longer than threshold
+func SlowerThanExemplar(threshold time.Duration) ExemplarSampler {
+	return func(_ *fasthttp.RequestCtx, dur time.Duration) bool {
+		return dur > threshold
+	}
+}
+
+// exemplar returns the labels of the first extractor which has an exemplar for ctx
+func (p *Prometheus) exemplar(ctx *fasthttp.RequestCtx) (labels prometheus.Labels) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			p.instrumentationError(reasonExtractorPanic, rcv)
+			labels = nil
+		}
+	}()
+	for _, extract := range p.exemplars {
+		if labels := extract(ctx); labels != nil {
+			return labels
+		}
+	}
+
+	return nil
+}
+
+// TraceparentExemplar reads the trace and span IDs of the W3C traceparent request header
+// as trace_id and span_id exemplar labels
+func TraceparentExemplar(ctx *fasthttp.RequestCtx) prometheus.Labels {
+	// version-traceid-parentid-flags, f.e 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+	parts := bytes.Split(ctx.Request.Header.Peek("traceparent"), []byte{'-'})
+	if len(parts) < 4 || len(parts[1]) != 32 || len(parts[2]) != 16 || !isHexBytes(parts[1]) || !isHexBytes(parts[2]) {
+		return nil
+	}
+
+	return prometheus.Labels{"trace_id": string(parts[1]), "span_id": string(parts[2])}
+}
+
+func isHexBytes(b []byte) bool {
+	for _, c := range b {
+		if !isHex(c) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,75 @@
+package fasthttpprom
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// externalMetricValueList is the external.metrics.k8s.io/v1beta1 ExternalMetricValueList
+type externalMetricValueList struct {
+	Kind       string                `json:"kind"`
+	APIVersion string                `json:"apiVersion"`
+	Metadata   struct{}              `json:"metadata"`
+	Items      []externalMetricValue `json:"items"`
+}
+
+type externalMetricValue struct {
+	MetricName   string            `json:"metricName"`
+	MetricLabels map[string]string `json:"metricLabels"`
+	Timestamp    string            `json:"timestamp"`
+	Value        string            `json:"value"`
+}
+
+// ExternalMetrics renders the request rates of the routes with the path labels paths, or
+// of every route if none are given, as an external.metrics.k8s.io/v1beta1
+// ExternalMetricValueList named metricName with a path label, so an HPA metrics adapter
+// can scale on request rate without querying Prometheus. The rates are taken over the
+// window configured with WithRouteStats, which is required.
+func (p *Prometheus) ExternalMetrics(metricName string, paths ...string) ([]byte, error) {
+	if p.routeStats == nil {
+		return nil, errors.New("fasthttpprom: external metrics need WithRouteStats")
+	}
+	selected := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		selected[path] = true
+	}
+
+	now := p.clock.Now()
+	list := externalMetricValueList{
+		Kind:       "ExternalMetricValueList",
+		APIVersion: "external.metrics.k8s.io/v1beta1",
+		Items:      []externalMetricValue{},
+	}
+	for _, rs := range p.routeStats.snapshot(now) {
+		if len(selected) > 0 && !selected[rs.Path] {
+			continue
+		}
+		list.Items = append(list.Items, externalMetricValue{
+			MetricName:   metricName,
+			MetricLabels: map[string]string{"path": rs.Path},
+			Timestamp:    now.UTC().Format(time.RFC3339),
+			// a Kubernetes quantity in thousandths, f.e 1500m for 1.5 requests per second
+			Value: strconv.FormatInt(int64(rs.RPS*1000+0.5), 10) + "m",
+		})
+	}
+
+	return json.Marshal(list)
+}
+
+// ExternalMetricsHandler serves ExternalMetrics(metricName, paths...), f.e for an adapter
+// proxying the external metrics API to the pods
+func (p *Prometheus) ExternalMetricsHandler(metricName string, paths ...string) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		body, err := p.ExternalMetrics(metricName, paths...)
+		if err != nil {
+			ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+			return
+		}
+		ctx.SetContentType("application/json")
+		ctx.SetBody(body)
+	}
+}
@@ -0,0 +1,75 @@
+package fasthttpprom
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// handlerErrorKey is the user value holding the error reported by SetError
+const handlerErrorKey = "fasthttpprom.error"
+
+// untypedError is the error_type label of errors which do not implement ErrorTyper
+const untypedError = "error"
+
+// ErrorTyper is implemented by errors which set their error_type label of
+// handler_errors_total
+type ErrorTyper interface {
+	ErrorType() string
+}
+
+// SetError reports a business level error of the request, which the middleware counts
+// with WithHandlerErrors in handler_errors_total by path and error_type whatever the
+// status code. The error
+// type is the one returned by the first ErrorTyper in the chain of err, or "error"
+// otherwise. Setting a nil error clears it.
+func SetError(ctx *fasthttp.RequestCtx, err error) {
+	if err == nil {
+		ctx.RemoveUserValue(handlerErrorKey)
+		return
+	}
+	ctx.SetUserValue(handlerErrorKey, err)
+}
+
+// WithHandlerErrors counts the errors handlers report with SetError in
+// handler_errors_total by path and error_type
+func WithHandlerErrors() Option {
+	return func(p *Prometheus) {
+		p.handlerErrorMetrics = true
+	}
+}
+
+func (p *Prometheus) registerHandlerErrorMetrics(subsystem string) {
+	p.handlerErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: subsystem,
+			Name:      "handler_errors_total",
+			Help:      "errors reported by handlers with SetError by type",
+		},
+		[]string{"path", "error_type"},
+	)
+	prometheus.Register(p.handlerErrors)
+}
+
+// countHandlerError counts the error the handler of ctx reported, if any
+func (p *Prometheus) countHandlerError(ctx *fasthttp.RequestCtx, ep string) {
+	if !p.handlerErrorMetrics || !p.recording() {
+		return
+	}
+	err, ok := ctx.UserValue(handlerErrorKey).(error)
+	if !ok {
+		return
+	}
+	p.handlerErrors.WithLabelValues(ep, errorType(err)).Inc()
+}
+
+// errorType returns the error_type label of err, also when its ErrorTyper is wrapped
+func errorType(err error) string {
+	var typer ErrorTyper
+	if errors.As(err, &typer) {
+		return typer.ErrorType()
+	}
+
+	return untypedError
+}
@@ -0,0 +1,62 @@
+package fasthttpprom
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+type typedError string
+
+func (e typedError) Error() string     { return string(e) }
+func (e typedError) ErrorType() string { return "typed_" + string(e) }
+
+func TestErrorType(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{typedError("quota"), "typed_quota"},
+		{fmt.Errorf("charge: %w", typedError("payment")), "typed_payment"},
+		{fmt.Errorf("outer: %w", fmt.Errorf("inner: %w", typedError("deep"))), "typed_deep"},
+		{errors.New("plain"), untypedError},
+		{fmt.Errorf("wrapped: %w", errors.New("plain")), untypedError},
+	} {
+		if got := errorType(tc.err); got != tc.want {
+			t.Errorf("errorType(%v) = %q, want %q", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestHandlerErrorMetrics(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"enabled":  {WithHandlerErrors(), WithMaintenanceMode()},
+		"disabled": nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := router.New()
+			r.GET("/charge", func(ctx *fasthttp.RequestCtx) { SetError(ctx, typedError("payment")) })
+			subsystem := "test_handler_error_metrics_" + name
+			p := newTestPrometheus(t, subsystem, r, opts...)
+
+			serve(p.Handler, fasthttp.MethodGet, "/charge")
+			p.SetMaintenance(true)
+
+			for _, metric := range []string{"handler_errors_total", "maintenance_mode"} {
+				exported := len(gatheredLabels(t, subsystem+"_"+metric)) > 0
+				if exported != (opts != nil) {
+					t.Errorf("%s exported = %v", metric, exported)
+				}
+			}
+			if v, _ := metricValue(t, subsystem+"_handler_errors_total", map[string]string{"path": "GET_/charge", "error_type": "typed_payment"}); opts != nil && v != 1 {
+				t.Errorf("handler_errors_total = %v, want 1", v)
+			}
+			if !p.Maintenance() {
+				t.Error("maintenance mode not set")
+			}
+		})
+	}
+}
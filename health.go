@@ -0,0 +1,165 @@
+package fasthttpprom
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	defaultHealthzPath    = "/healthz"
+	defaultHealthInterval = 10 * time.Second
+	defaultHealthTimeout  = 5 * time.Second
+)
+
+// HealthCheck probes a dependency, f.e pinging a database, returning an error when it is
+// unavailable
+type HealthCheck func(ctx context.Context) error
+
+// HealthConfig configures the dependency health checks
+type HealthConfig struct {
+	// Interval between runs of the checks, 10s if zero
+	Interval time.Duration
+	// Timeout of a single check, 5s if zero
+	Timeout time.Duration
+}
+
+// WithHealthChecks runs the checks added with AddHealthCheck every cfg.Interval until
+// Close is called, serving their results on /healthz of the instrumented router and
+// exporting them in dependency_up by name
+func WithHealthChecks(cfg HealthConfig) Option {
+	return func(p *Prometheus) {
+		if cfg.Interval <= 0 {
+			cfg.Interval = defaultHealthInterval
+		}
+		if cfg.Timeout <= 0 {
+			cfg.Timeout = defaultHealthTimeout
+		}
+		p.health = &healthChecks{cfg: cfg, checks: make(map[string]HealthCheck), errs: make(map[string]error)}
+	}
+}
+
+// WithHealthzPath serves the results of WithHealthChecks on path instead of /healthz.
+// An empty path serves them nowhere, f.e to mount HealthzHandler on a route of the
+// application.
+func WithHealthzPath(path string) Option {
+	return func(p *Prometheus) {
+		p.healthzPath = path
+	}
+}
+
+// healthChecks holds the checks and their last results
+type healthChecks struct {
+	cfg    HealthConfig
+	up     *prometheus.GaugeVec
+	mu     sync.RWMutex
+	checks map[string]HealthCheck
+	errs   map[string]error
+}
+
+func (p *Prometheus) registerHealthChecks(subsystem string) {
+	p.health.up = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: subsystem,
+			Name:      "dependency_up",
+			Help:      "whether the last health check of the dependency passed",
+		},
+		[]string{"name"},
+	)
+	prometheus.Register(p.health.up)
+	p.runEvery(p.health.cfg.Interval, 0, p.runHealthChecks, nil)
+}
+
+// AddHealthCheck adds the check of the dependency name, running it right away so its
+// result is known before the first interval passes. It does nothing without
+// WithHealthChecks.
+func (p *Prometheus) AddHealthCheck(name string, check HealthCheck) {
+	if p.health == nil {
+		return
+	}
+	p.health.mu.Lock()
+	p.health.checks[name] = check
+	p.health.mu.Unlock()
+	p.runHealthCheck(name, check)
+}
+
+// runHealthChecks runs every check
+func (p *Prometheus) runHealthChecks() {
+	p.health.mu.RLock()
+	checks := make(map[string]HealthCheck, len(p.health.checks))
+	for name, check := range p.health.checks {
+		checks[name] = check
+	}
+	p.health.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check HealthCheck) {
+			defer wg.Done()
+			p.runHealthCheck(name, check)
+		}(name, check)
+	}
+	wg.Wait()
+}
+
+// runHealthCheck runs check and records its result
+func (p *Prometheus) runHealthCheck(name string, check HealthCheck) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.health.cfg.Timeout)
+	defer cancel()
+	err := check(ctx)
+
+	p.health.mu.Lock()
+	p.health.errs[name] = err
+	p.health.mu.Unlock()
+	up := 0.0
+	if err == nil {
+		up = 1
+	}
+	p.health.up.WithLabelValues(name).Set(up)
+}
+
+// healthStatus is the JSON form of the health check results
+type healthStatus struct {
+	Status string                 `json:"status"`
+	Checks map[string]healthCheck `json:"checks"`
+}
+
+type healthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HealthzHandler serves the last results of the checks as JSON, answering 503 Service
+// Unavailable when one of them failed, or 404 Not Found without WithHealthChecks
+func (p *Prometheus) HealthzHandler() fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if p.health == nil {
+			ctx.Error("health checks not enabled", fasthttp.StatusNotFound)
+			return
+		}
+		status := healthStatus{Status: "pass", Checks: make(map[string]healthCheck)}
+		p.health.mu.RLock()
+		for name, err := range p.health.errs {
+			check := healthCheck{Status: "pass"}
+			if err != nil {
+				check = healthCheck{Status: "fail", Error: err.Error()}
+				status.Status = "fail"
+			}
+			status.Checks[name] = check
+		}
+		p.health.mu.RUnlock()
+
+		if status.Status != "pass" {
+			ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+		}
+		ctx.SetContentType("application/json")
+		if err := json.NewEncoder(ctx).Encode(status); err != nil {
+			ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package fasthttpprom
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+func TestHealthzApplicationRoute(t *testing.T) {
+	r := router.New()
+	r.GET(defaultHealthzPath, func(ctx *fasthttp.RequestCtx) { ctx.SetBodyString("app") })
+	p := newTestPrometheus(t, "test_healthz_application_route", r, WithHealthChecks(HealthConfig{}))
+
+	ctx := serve(p.Handler, fasthttp.MethodGet, defaultHealthzPath)
+	if body := string(ctx.Response.Body()); body != "app" {
+		t.Errorf("GET %s answered %q, want the application route", defaultHealthzPath, body)
+	}
+}
+
+func TestHealthzPath(t *testing.T) {
+	r := router.New()
+	p := NewPrometheus("test_healthz_path", WithHealthChecks(HealthConfig{}), WithHealthzPath("/-/healthz"))
+	defer p.Close()
+	if err := p.Use(r); err != nil {
+		t.Fatal(err)
+	}
+	p.AddHealthCheck("db", func(ctx context.Context) error { return errors.New("down") })
+
+	ctx := serve(p.Handler, fasthttp.MethodGet, "/-/healthz")
+	if ctx.Response.StatusCode() != fasthttp.StatusServiceUnavailable {
+		t.Errorf("GET /-/healthz with a failing check = %d, want 503", ctx.Response.StatusCode())
+	}
+	if ctx := serve(p.Handler, fasthttp.MethodGet, defaultHealthzPath); ctx.Response.StatusCode() != fasthttp.StatusNotFound {
+		t.Errorf("GET %s = %d, want 404", defaultHealthzPath, ctx.Response.StatusCode())
+	}
+}
+
+func TestHealthzHandler(t *testing.T) {
+	r := router.New()
+	p := NewPrometheus("test_healthz_handler", WithHealthChecks(HealthConfig{}), WithHealthzPath(""))
+	defer p.Close()
+	r.GET("/internal/health", p.HealthzHandler())
+	if err := p.Use(r); err != nil {
+		t.Fatal(err)
+	}
+	p.AddHealthCheck("db", func(ctx context.Context) error { return nil })
+
+	ctx := serve(p.Handler, fasthttp.MethodGet, "/internal/health")
+	if ctx.Response.StatusCode() != fasthttp.StatusOK || string(ctx.Response.Header.ContentType()) != "application/json" {
+		t.Errorf("GET /internal/health = %d %s", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+	if ctx := serve(p.Handler, fasthttp.MethodGet, defaultHealthzPath); ctx.Response.StatusCode() != fasthttp.StatusNotFound {
+		t.Errorf("GET %s without a path = %d, want 404", defaultHealthzPath, ctx.Response.StatusCode())
+	}
+}
@@ -0,0 +1,38 @@
+package fasthttpprom
+
+import (
+	"strconv"
+
+	"github.com/valyala/fasthttp"
+)
+
+// HijackMode selects how requests whose handler hijacked the connection are recorded.
+// Their duration only covers the handler, not the hijacked connection.
+type HijackMode int
+
+const (
+	// HijackExclude does not record hijacked requests. It is the default.
+	HijackExclude HijackMode = iota
+	// HijackLabel records every request with a hijacked label, "true" for hijacked
+	// requests
+	HijackLabel
+	// HijackRecord records hijacked requests like any other
+	HijackRecord
+)
+
+// WithHijackMode sets how requests which hijacked the connection are recorded. WebSocket
+// upgrades are tracked separately whatever the mode.
+func WithHijackMode(mode HijackMode) Option {
+	return func(p *Prometheus) {
+		p.hijackMode = mode
+		if mode == HijackLabel {
+			p.labelSources = append(p.labelSources, labelSource{
+				name: "hijacked",
+				extract: func(ctx *fasthttp.RequestCtx) string {
+					return strconv.FormatBool(ctx.Hijacked())
+				},
+				values: 2,
+			})
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Package influx writes the middleware's request metrics as InfluxDB line protocol, so
+// InfluxDB/Telegraf stacks can adopt the middleware without running Prometheus.
+//
+// Observations are aggregated per method, path and code and written on every flush as
+//
+//	request_duration,method=GET,path=/health,code=200 count=10i,sum=0.012,max=0.004 1672531200000000000
+package influx
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	fasthttpprom "github.com/carousell/fasthttp-prometheus-middleware"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	defaultMeasurement   = "request_duration"
+	defaultFlushInterval = 10 * time.Second
+	defaultTimeout       = 10 * time.Second
+)
+
+// Config configures an InfluxDB backend
+type Config struct {
+	// URL is either the HTTP write endpoint including its query, f.e
+	// http://localhost:8086/api/v2/write?org=acme&bucket=api or
+	// http://localhost:8086/write?db=api, or udp://host:port for the UDP listener
+	URL string
+	// Token is sent as "Authorization: Token <token>" with HTTP writes
+	Token string
+	// Measurement name, request_duration if empty
+	Measurement string
+	// Tags are added to every point
+	Tags map[string]string
+	// FlushInterval between writes, 10s if zero
+	FlushInterval time.Duration
+	// Timeout of HTTP writes, 10s if zero
+	Timeout time.Duration
+	// ErrorHandler is called with every failed write. Errors are logged when it is nil.
+	ErrorHandler func(error)
+}
+
+type seriesKey struct {
+	method, path, code string
+}
+
+type aggregate struct {
+	count    int64
+	sum, max float64
+}
+
+// Backend aggregates request observations and writes them as line protocol
+type Backend struct {
+	cfg       Config
+	constTags string
+	udp       net.Conn
+	client    *fasthttp.Client
+
+	mu     sync.Mutex
+	series map[seriesKey]*aggregate
+	onDrop atomic.Pointer[func(n int)]
+
+	done     chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// New creates a backend writing to cfg.URL every cfg.FlushInterval
+func New(cfg Config) (*Backend, error) {
+	if cfg.Measurement == "" {
+		cfg.Measurement = defaultMeasurement
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	b := &Backend{
+		cfg:       cfg,
+		constTags: formatTags(cfg.Tags),
+		series:    make(map[seriesKey]*aggregate),
+		done:      make(chan struct{}),
+	}
+	switch u.Scheme {
+	case "udp":
+		if b.udp, err = net.Dial("udp", u.Host); err != nil {
+			return nil, err
+		}
+	case "http", "https":
+		b.client = &fasthttp.Client{}
+	default:
+		return nil, fmt.Errorf("influx: unsupported URL scheme %q", u.Scheme)
+	}
+	b.wg.Add(1)
+	go b.run()
+
+	return b, nil
+}
+
+// Record implements fasthttpprom.MetricsBackend
+func (b *Backend) Record(o fasthttpprom.Observation) {
+	key := seriesKey{o.Method, o.Route(), o.Code}
+	seconds := o.Duration.Seconds()
+
+	b.mu.Lock()
+	agg, ok := b.series[key]
+	if !ok {
+		agg = &aggregate{}
+		b.series[key] = agg
+	}
+	agg.count++
+	agg.sum += seconds
+	if seconds > agg.max {
+		agg.max = seconds
+	}
+	b.mu.Unlock()
+}
+
+// Flush writes the observations aggregated since the previous flush, which are dropped
+// when the write fails
+func (b *Backend) Flush() error {
+	b.mu.Lock()
+	series := b.series
+	b.series = make(map[seriesKey]*aggregate, len(series))
+	b.mu.Unlock()
+	if len(series) == 0 {
+		return nil
+	}
+
+	ts := strconv.FormatInt(time.Now().UnixNano(), 10)
+	var lines []byte
+	var count int64
+	for key, agg := range series {
+		count += agg.count
+		lines = append(lines, escape(b.cfg.Measurement, ", ")...)
+		lines = append(lines, ",method="...)
+		lines = append(lines, escape(key.method, ",= ")...)
+		lines = append(lines, ",path="...)
+		lines = append(lines, escape(key.path, ",= ")...)
+		lines = append(lines, ",code="...)
+		lines = append(lines, escape(key.code, ",= ")...)
+		lines = append(lines, b.constTags...)
+		lines = append(lines, " count="...)
+		lines = strconv.AppendInt(lines, agg.count, 10)
+		lines = append(lines, "i,sum="...)
+		lines = strconv.AppendFloat(lines, agg.sum, 'g', -1, 64)
+		lines = append(lines, ",max="...)
+		lines = strconv.AppendFloat(lines, agg.max, 'g', -1, 64)
+		lines = append(lines, ' ')
+		lines = append(lines, ts...)
+		lines = append(lines, '\n')
+	}
+
+	err := b.write(lines)
+	if err != nil {
+		if fn := b.onDrop.Load(); fn != nil {
+			(*fn)(int(count))
+		}
+	}
+
+	return err
+}
+
+// SetDropHandler implements fasthttpprom.DropReporter, fn is called with the number of
+// observations lost by failed writes
+func (b *Backend) SetDropHandler(fn func(n int)) {
+	b.onDrop.Store(&fn)
+}
+
+// Close stops the flush loop and writes the remaining observations
+func (b *Backend) Close() error {
+	b.stopOnce.Do(func() { close(b.done) })
+	b.wg.Wait()
+	err := b.Flush()
+	if b.udp != nil {
+		if cerr := b.udp.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+func (b *Backend) run() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.Flush(); err != nil {
+				b.handleError(err)
+			}
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *Backend) write(lines []byte) error {
+	if b.udp != nil {
+		_, err := b.udp.Write(lines)
+		return err
+	}
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.SetRequestURI(b.cfg.URL)
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.SetContentType("text/plain; charset=utf-8")
+	if b.cfg.Token != "" {
+		req.Header.Set("Authorization", "Token "+b.cfg.Token)
+	}
+	req.SetBody(lines)
+	if err := b.client.DoTimeout(req, resp, b.cfg.Timeout); err != nil {
+		return err
+	}
+	if code := resp.StatusCode(); code/100 != 2 {
+		return fmt.Errorf("influx: unexpected status code %d", code)
+	}
+
+	return nil
+}
+
+func (b *Backend) handleError(err error) {
+	if b.cfg.ErrorHandler != nil {
+		b.cfg.ErrorHandler(err)
+		return
+	}
+	log.Printf("Fail to write metrics to InfluxDB: %s\n", err)
+}
+
+// formatTags renders tags sorted by key as a ",k=v" suffix of the series key
+func formatTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteByte(',')
+		sb.WriteString(escape(k, ",= "))
+		sb.WriteByte('=')
+		sb.WriteString(escape(tags[k], ",= "))
+	}
+
+	return sb.String()
+}
+
+// escape backslash-escapes the characters of chars in s, and drops newlines which line
+// protocol cannot carry
+func escape(s, chars string) string {
+	if !strings.ContainsAny(s, chars+"\n") {
+		return s
+	}
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\n':
+		case strings.ContainsRune(chars, r):
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,58 @@
+package influx
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	fasthttpprom "github.com/carousell/fasthttp-prometheus-middleware"
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+func TestBackend(t *testing.T) {
+	var mu sync.Mutex
+	var body, auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		body, auth = string(b), r.Header.Get("Authorization")
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	b, err := New(Config{URL: srv.URL + "/api/v2/write?bucket=api", Token: "secret", Tags: map[string]string{"env": "test"}, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := router.New()
+	r.GET("/users/{id}", func(ctx *fasthttp.RequestCtx) {})
+	p := fasthttpprom.NewPrometheus("test_influx_backend", fasthttpprom.WithOnlyBackend(b))
+	defer p.Close()
+	if err := p.Use(r); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI("/users/1")
+		p.Handler(ctx)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := regexp.MustCompile(`^request_duration,method=GET,path=/users/\{id\},code=200,env=test count=2i,sum=[0-9.e-]+,max=[0-9.e-]+ [0-9]+\n$`)
+	if !want.MatchString(body) {
+		t.Errorf("wrote %q, want %s", body, want)
+	}
+	if auth != "Token secret" {
+		t.Errorf("Authorization = %q", auth)
+	}
+}
@@ -0,0 +1,77 @@
+package fasthttpprom
+
+import (
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// reasons of instrumentation_errors_total
+const (
+	// reasonLabelValues counts observations rejected by the histogram, f.e for a wrong
+	// number of label values
+	reasonLabelValues = "label_values"
+	// reasonExtractorPanic counts panics of exemplar extractors and label sources
+	reasonExtractorPanic = "extractor_panic"
+	// reasonExemplar counts exemplars rejected by the histogram, f.e for being too long
+	reasonExemplar = "exemplar"
+	// reasonBackendPanic counts panics of metrics backends
+	reasonBackendPanic = "backend_panic"
+	// reasonDropped counts observations lost by asynchronous backends
+	reasonDropped = "dropped"
+)
+
+func (p *Prometheus) registerInstrumentationErrors(subsystem string) {
+	p.instrumentationErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: subsystem,
+			Name:      "instrumentation_errors_total",
+			Help:      "failures of the middleware to record a request by reason",
+		},
+		[]string{"reason"},
+	)
+	for _, reason := range []string{reasonLabelValues, reasonExtractorPanic, reasonExemplar, reasonBackendPanic, reasonDropped} {
+		p.instrumentationErrors.WithLabelValues(reason)
+	}
+	prometheus.Register(p.instrumentationErrors)
+}
+
+// instrumentationError counts a failure to record a request, logging err
+func (p *Prometheus) instrumentationError(reason string, err interface{}) {
+	p.instrumentationErrors.WithLabelValues(reason).Inc()
+	log.Printf("Fail to record request (%s): %v\n", reason, err)
+}
+
+// reportDrops counts the observations dropped by the backends implementing DropReporter
+func (p *Prometheus) reportDrops() {
+	dropped := p.instrumentationErrors.WithLabelValues(reasonDropped)
+	for _, b := range p.backends {
+		if r, ok := b.(DropReporter); ok {
+			r.SetDropHandler(func(n int) { dropped.Add(float64(n)) })
+		}
+	}
+}
+
+// safeExtract returns the value of source for ctx, or an empty value when it panics
+func (p *Prometheus) safeExtract(ctx *fasthttp.RequestCtx, source labelSource) (v string) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			p.instrumentationError(reasonExtractorPanic, rcv)
+			v = ""
+		}
+	}()
+
+	return source.extract(ctx)
+}
+
+// safeRecord hands o to b, counting its panics
+func (p *Prometheus) safeRecord(b MetricsBackend, o Observation) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			p.instrumentationError(reasonBackendPanic, rcv)
+		}
+	}()
+
+	b.Record(o)
+}
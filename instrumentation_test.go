@@ -0,0 +1,104 @@
+package fasthttpprom
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fasthttp/router"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/valyala/fasthttp"
+)
+
+// metricValue returns the value of the counter, gauge or the count of the histogram
+// named name with labels, and whether it exists
+func metricValue(t *testing.T, name string, labels map[string]string) (float64, bool) {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			if matchLabels(m, labels) {
+				switch {
+				case m.Counter != nil:
+					return m.GetCounter().GetValue(), true
+				case m.Gauge != nil:
+					return m.GetGauge().GetValue(), true
+				case m.Histogram != nil:
+					return float64(m.GetHistogram().GetSampleCount()), true
+				}
+			}
+		}
+	}
+
+	return 0, false
+}
+
+func matchLabels(m *dto.Metric, labels map[string]string) bool {
+	matched := 0
+	for _, pair := range m.GetLabel() {
+		if v, ok := labels[pair.GetName()]; ok {
+			if v != pair.GetValue() {
+				return false
+			}
+			matched++
+		}
+	}
+
+	return matched == len(labels)
+}
+
+func TestRejectedExemplarObservedOnce(t *testing.T) {
+	tooLong := func(ctx *fasthttp.RequestCtx) prometheus.Labels {
+		// exemplar labels are limited to 128 runes
+		return prometheus.Labels{"trace_id": strings.Repeat("a", 200)}
+	}
+	r := router.New()
+	r.GET("/a", func(ctx *fasthttp.RequestCtx) {})
+	p := newTestPrometheus(t, "test_exemplar_once", r, WithExemplars(tooLong), WithLabelMigration(MigrationConfig{}))
+
+	serve(p.Handler, fasthttp.MethodGet, "/a")
+
+	for name, labels := range map[string]map[string]string{
+		"test_exemplar_once_request_duration_seconds":     {"path": "GET_/a"},
+		"test_exemplar_once_request_duration_v2_seconds":  {"method": "GET", "path": "/a"},
+		"test_exemplar_once_instrumentation_errors_total": {"reason": reasonExemplar},
+	} {
+		want := 1.0
+		if name == "test_exemplar_once_instrumentation_errors_total" {
+			// one for each histogram
+			want = 2
+		}
+		if got, _ := metricValue(t, name, labels); got != want {
+			t.Errorf("%s%v = %v, want %v", name, labels, got, want)
+		}
+	}
+}
+
+// droppingBackend drops every observation, reporting it
+type droppingBackend struct {
+	drop func(n int)
+}
+
+func (b *droppingBackend) Record(o Observation) { b.drop(1) }
+
+func (b *droppingBackend) SetDropHandler(fn func(n int)) { b.drop = fn }
+
+func TestDroppedObservations(t *testing.T) {
+	r := router.New()
+	r.GET("/a", func(ctx *fasthttp.RequestCtx) {})
+	p := newTestPrometheus(t, "test_dropped", r, WithBackend(&droppingBackend{}))
+
+	serve(p.Handler, fasthttp.MethodGet, "/a")
+	serve(p.Handler, fasthttp.MethodGet, "/a")
+
+	labels := map[string]string{"reason": reasonDropped}
+	if got, _ := metricValue(t, "test_dropped_instrumentation_errors_total", labels); got != 2 {
+		t.Errorf("dropped observations = %v, want 2", got)
+	}
+}
@@ -0,0 +1,94 @@
+package fasthttpprom
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+
+	"github.com/valyala/fasthttp"
+)
+
+// defaultMaxClaimValues caps the distinct values of a claim label
+const defaultMaxClaimValues = 100
+
+// JWTClaimConfig configures a label taken from a claim of the bearer token in the
+// Authorization header
+type JWTClaimConfig struct {
+	// Claim is the name of the claim, f.e "client_id"
+	Claim string
+	// Label is the name of the label, Claim if empty
+	Label string
+	// MaxValues caps the distinct label values, further values are recorded as
+	// "overflow". 100 if zero.
+	MaxValues int
+	// Verify checks the signature of the token. Claims are read without verification
+	// when it is nil, tokens failing it are recorded as "invalid".
+	Verify func(token []byte) error
+}
+
+// WithJWTClaimLabel adds a label to request_duration_seconds with the value of an
+// allowlisted claim of the request's bearer token, f.e for per client SLAs. Requests
+// without a token or the claim are recorded as "none".
+func WithJWTClaimLabel(cfg JWTClaimConfig) Option {
+	if cfg.Label == "" {
+		cfg.Label = cfg.Claim
+	}
+	if cfg.MaxValues <= 0 {
+		cfg.MaxValues = defaultMaxClaimValues
+	}
+	values := newPathGuard(cfg.MaxValues)
+
+	return func(p *Prometheus) {
+		p.labelSources = append(p.labelSources, labelSource{
+			name: cfg.Label,
+			extract: func(ctx *fasthttp.RequestCtx) string {
+				v := jwtClaim(ctx, cfg)
+				if v == "none" || v == "invalid" || values.admit(v) {
+					return v
+				}
+				return overflowPath
+			},
+			values: cfg.MaxValues + 3,
+		})
+	}
+}
+
+// jwtClaim returns the string value of the configured claim of the bearer token of ctx
+func jwtClaim(ctx *fasthttp.RequestCtx, cfg JWTClaimConfig) string {
+	auth := ctx.Request.Header.Peek(fasthttp.HeaderAuthorization)
+	prefix := []byte("Bearer ")
+	if len(auth) <= len(prefix) || !bytes.EqualFold(auth[:len(prefix)], prefix) {
+		return "none"
+	}
+	token := auth[len(prefix):]
+	// header.payload.signature
+	parts := bytes.Split(token, []byte{'.'})
+	if len(parts) != 3 {
+		return "invalid"
+	}
+	if cfg.Verify != nil && cfg.Verify(token) != nil {
+		return "invalid"
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(string(bytes.TrimRight(parts[1], "=")))
+	if err != nil {
+		return "invalid"
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "invalid"
+	}
+
+	switch v := claims[cfg.Claim].(type) {
+	case nil:
+		return "none"
+	case string:
+		return sanitizeLabel(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	return "invalid"
+}
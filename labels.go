@@ -0,0 +1,158 @@
+package fasthttpprom
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fasthttp/router"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// FallbackMode selects the path label of requests whose route could not be resolved,
+// other than 404s and the requests answered by a custom NotFound handler
+type FallbackMode int
+
+const (
+	// FallbackPath records the request path, normalized by the PathNormalizer if any.
+	// It is the default.
+	FallbackPath FallbackMode = iota
+	// FallbackUnknown records the requests as path="unknown"
+	FallbackUnknown
+	// FallbackDrop does not record the requests
+	FallbackDrop
+)
+
+// unknownPath is the path label of unresolved requests with FallbackUnknown
+const unknownPath = "unknown"
+
+// otherMethod is the method label of requests with a method which is neither standard
+// nor registered on the router, f.e from raw TCP probes
+const otherMethod = "other"
+
+// methodLabel bounds the method label to the standard methods and the custom methods
+// routes are registered for, so arbitrary methods sent by clients don't create series
+func (p *Prometheus) methodLabel(method string) string {
+	switch method {
+	case fasthttp.MethodGet, fasthttp.MethodHead, fasthttp.MethodPost, fasthttp.MethodPut,
+		fasthttp.MethodPatch, fasthttp.MethodDelete, fasthttp.MethodConnect,
+		fasthttp.MethodOptions, fasthttp.MethodTrace:
+		return method
+	}
+	if method != "" && method != router.MethodWild {
+		if _, ok := p.registeredRoutes()[method]; ok {
+			return method
+		}
+	}
+
+	return otherMethod
+}
+
+// labelSource adds a label to request_duration_seconds, its value extracted from the
+// request
+type labelSource struct {
+	name    string
+	extract func(ctx *fasthttp.RequestCtx) string
+	// values is the number of distinct values extract returns at most
+	values int
+}
+
+// extraLabels returns the values of the additional labels for ctx, cut at any query
+// string or fragment the extractors copy from the request
+func (p *Prometheus) extraLabels(ctx *fasthttp.RequestCtx) prometheus.Labels {
+	labels := make(prometheus.Labels, len(p.labelSources))
+	for _, source := range p.labelSources {
+		labels[source.name] = stripQuery(p.safeExtract(ctx, source))
+	}
+
+	return labels
+}
+
+// boundedLabel returns v if it is one of allowed, otherwise "other", or "unknown" when
+// v is empty
+func boundedLabel(v string, allowed map[string]bool) string {
+	switch {
+	case v == "":
+		return "unknown"
+	case allowed[v]:
+		return v
+	}
+
+	return "other"
+}
+
+// truncationMarker is appended to label values cut at the maximum label length
+const truncationMarker = "..."
+
+// truncateLabel cuts v to at most max bytes including the truncation marker, without
+// splitting a multi-byte character
+func truncateLabel(v string, max int) string {
+	if max <= 0 || len(v) <= max {
+		return v
+	}
+	if max <= len(truncationMarker) {
+		return truncationMarker[:max]
+	}
+	cut := max - len(truncationMarker)
+	for cut > 0 && !utf8.RuneStart(v[cut]) {
+		cut--
+	}
+
+	return v[:cut] + truncationMarker
+}
+
+// stripQuery cuts a request path at the first ? or #, so query strings and fragments,
+// which may hold tokens, never end up in labels even when smuggled in percent-encoded.
+// Route patterns are not stripped since optional parameters end with ?.
+func stripQuery(path string) string {
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		return path[:i]
+	}
+
+	return path
+}
+
+// stripPatternQuery is stripQuery for labels which may hold route patterns, keeping the
+// ? and # within the braces of optional and regular expression parameters
+func stripPatternQuery(label string) string {
+	depth := 0
+	for i := 0; i < len(label); i++ {
+		switch label[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth > 0 {
+				depth--
+			}
+		case '?', '#':
+			if depth == 0 {
+				return label[:i]
+			}
+		}
+	}
+
+	return label
+}
+
+// cleanPathLabel replaces invalid UTF-8 in a request path. The path is not decoded here:
+// fasthttp already percent-decodes URI().Path(), so decoding it again would turn f.e
+// /a%2541 into /aA, while %2F and mixed-case escapes are decoded to the same path.
+func cleanPathLabel(path string) string {
+	return strings.ToValidUTF8(path, string(utf8.RuneError))
+}
+
+// sanitizeLabel strips control characters such as newlines from a derived label value so
+// request data cannot corrupt the text exposition format
+func sanitizeLabel(v string) string {
+	if strings.IndexFunc(v, unicode.IsControl) < 0 {
+		return v
+	}
+
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, v)
+}
@@ -0,0 +1,106 @@
+package fasthttpprom
+
+import (
+	"bufio"
+	"io"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+func TestStripQuery(t *testing.T) {
+	for _, tc := range []struct {
+		label, query, pattern string
+	}{
+		{"/users", "/users", "/users"},
+		{"/users?token=abc", "/users", "/users"},
+		{"/users#token=abc", "/users", "/users"},
+		{"/users/{id?}", "/users/{id", "/users/{id?}"},
+		{"/users/{id:[0-9]+?}?token=abc", "/users/{id:[0-9]+", "/users/{id:[0-9]+?}"},
+		{"/users/{id}#a?b", "/users/{id}", "/users/{id}"},
+	} {
+		if got := stripQuery(tc.label); got != tc.query {
+			t.Errorf("stripQuery(%q) = %q, want %q", tc.label, got, tc.query)
+		}
+		if got := stripPatternQuery(tc.label); got != tc.pattern {
+			t.Errorf("stripPatternQuery(%q) = %q, want %q", tc.label, got, tc.pattern)
+		}
+	}
+}
+
+// requestPathLabel is a custom label source copying the decoded request path
+func requestPathLabel(p *Prometheus) {
+	p.labelSources = append(p.labelSources, labelSource{
+		name: "request_path",
+		extract: func(ctx *fasthttp.RequestCtx) string {
+			return string(ctx.Request.URI().Path())
+		},
+		values: 1,
+	})
+}
+
+func TestQueryNotInLabels(t *testing.T) {
+	r := router.New()
+	r.GET("/users/{id}", func(ctx *fasthttp.RequestCtx) {})
+	r.GET("/copy/{path:*}", func(ctx *fasthttp.RequestCtx) { ctx.SetBodyString("copy") })
+	rec := &recorder{}
+	p := newTestPrometheus(t, "test_query_labels", r, WithBackend(rec), requestPathLabel,
+		WithRelabel(func(labels map[string]string) map[string]string {
+			// a relabel func copying request data into the path label
+			if labels["path"] == "GET_/copy/{path:*}" {
+				labels["path"] = "GET_" + labels["request_path"]
+			}
+			return labels
+		}))
+
+	for uri, want := range map[string]string{
+		"/users/1%3Ftoken=abc": "GET_/users/{id}",
+		"/users/1%23token=abc": "GET_/users/{id}",
+		"/copy/a%3Ftoken=abc":  "GET_/copy/a",
+		"/copy/a%23token=abc":  "GET_/copy/a",
+	} {
+		serve(p.Handler, fasthttp.MethodGet, uri)
+		o := rec.last(t)
+		if o.Path != want {
+			t.Errorf("%s recorded with path %q, want %q", uri, o.Path, want)
+		}
+		if v := o.Labels["request_path"]; stripQuery(v) != v {
+			t.Errorf("%s recorded with request_path %q", uri, v)
+		}
+	}
+
+	for _, uri := range []string{"/a%3Ftoken=abc", "/a%23token=abc", "/a?token=abc"} {
+		var u fasthttp.URI
+		u.Parse(nil, []byte(uri))
+		if got := p.pathLabel(fasthttp.MethodGet, routeMatch{pattern: string(u.Path())}, "200"); got != "GET_/a" {
+			t.Errorf("path label of unmatched %s = %q, want GET_/a", uri, got)
+		}
+	}
+}
+
+func TestStreamMethodLabel(t *testing.T) {
+	r := router.New()
+	var p *Prometheus
+	r.ANY("/events", func(ctx *fasthttp.RequestCtx) {
+		p.SetBodyStreamWriter(ctx, func(w *bufio.Writer) { w.WriteString("event") })
+	})
+	p = newTestPrometheus(t, "test_stream_method_label", r)
+
+	for _, method := range []string{fasthttp.MethodGet, "JUNK1", "JUNK2"} {
+		ctx := serve(p.Handler, method, "/events")
+		if err := ctx.Response.Write(bufio.NewWriter(io.Discard)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var paths []string
+	for _, labels := range gatheredLabels(t, "test_stream_method_label_stream_bytes_total") {
+		paths = append(paths, labels["path"])
+	}
+	sort.Strings(paths)
+	if want := []string{"GET_/events", "other_/events"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("stream_bytes_total paths = %v, want %v", paths, want)
+	}
+}
@@ -0,0 +1,133 @@
+package fasthttpprom
+
+import (
+	"context"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// defaultDrainTimeout is the longest Run waits for in-flight requests
+const defaultDrainTimeout = 30 * time.Second
+
+// phases of Run, the phase label of lifecycle_phase
+const (
+	phaseServing  = "serving"
+	phaseNotReady = "not_ready"
+	phaseDraining = "draining"
+	phaseFlushing = "flushing"
+	phaseStopped  = "stopped"
+)
+
+var lifecyclePhases = []string{phaseServing, phaseNotReady, phaseDraining, phaseFlushing, phaseStopped}
+
+// LifecycleConfig configures the shutdown of Run
+type LifecycleConfig struct {
+	// ReadinessGrace is the time between reporting not ready and to stop accepting
+	// connections, so load balancers stop sending new requests first
+	ReadinessGrace time.Duration
+	// DrainTimeout is the longest in-flight requests are waited for, 30s if zero
+	DrainTimeout time.Duration
+}
+
+// WithLifecycle configures the shutdown of Run
+func WithLifecycle(cfg LifecycleConfig) Option {
+	return func(p *Prometheus) {
+		p.lifecycle = cfg
+	}
+}
+
+// Run adds the middleware to r, unless it already is, and serves r on addr, and on the
+// address of SetListenAddress if set, until ctx is done or SIGTERM or SIGINT is
+// received. It then reports not ready, waits for the readiness grace, stops accepting
+// connections, drains the in-flight requests, makes the final pushes and writes of
+// Close, closes the backends implementing io.Closer, flushing them, and stops the
+// metrics listener. The server is instrumented with NewServerCollector. The current
+// phase is exported in lifecycle_phase and the time it started in
+// lifecycle_phase_started_timestamp_seconds.
+func (p *Prometheus) Run(ctx context.Context, addr string, r *router.Router) error {
+	if err := p.Use(r); err != nil {
+		return err
+	}
+	if p.metricsListener == nil {
+		p.runServer()
+	}
+	phase := registerCollector(prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: p.subsystem,
+			Name:      "lifecycle_phase",
+			Help:      "current phase of the lifecycle of the server started by Run",
+		},
+		[]string{"phase"},
+	)).(*prometheus.GaugeVec)
+	started := registerCollector(prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: p.subsystem,
+			Name:      "lifecycle_phase_started_timestamp_seconds",
+			Help:      "time the phase of the lifecycle of the server started by Run started",
+		},
+		[]string{"phase"},
+	)).(*prometheus.GaugeVec)
+	enter := func(current string) {
+		for _, name := range lifecyclePhases {
+			phase.WithLabelValues(name).Set(0)
+		}
+		phase.WithLabelValues(current).Set(1)
+		started.WithLabelValues(current).SetToCurrentTime()
+	}
+
+	s := &fasthttp.Server{Handler: p.Handler, ErrorHandler: p.ErrorHandler(nil)}
+	NewServerCollector(s, p.subsystem)
+	serveErr := make(chan error, 1)
+	enter(phaseServing)
+	go func() {
+		serveErr <- s.ListenAndServe(addr)
+	}()
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-serveErr:
+	}
+
+	enter(phaseNotReady)
+	p.ready.Store(false)
+	if err == nil && p.lifecycle.ReadinessGrace > 0 {
+		time.Sleep(p.lifecycle.ReadinessGrace)
+	}
+
+	enter(phaseDraining)
+	drainTimeout := p.lifecycle.DrainTimeout
+	if drainTimeout <= 0 {
+		drainTimeout = defaultDrainTimeout
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- s.ShutdownWithContext(shutdownCtx)
+	}()
+	if drainErr := p.Drain(drainTimeout); err == nil {
+		err = drainErr
+	}
+	if sErr := <-shutdownErr; err == nil {
+		err = sErr
+	}
+
+	enter(phaseFlushing)
+	p.Close()
+	p.closeBackends()
+
+	enter(phaseStopped)
+	if p.metricsServer != nil {
+		p.metricsServer.Shutdown()
+	}
+
+	return err
+}
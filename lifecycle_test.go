@@ -0,0 +1,74 @@
+package fasthttpprom
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+// closingRecorder is a recorder implementing io.Closer
+type closingRecorder struct {
+	recorder
+	closed atomic.Bool
+}
+
+func (c *closingRecorder) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+// freeAddr returns an address of the loopback interface nothing listens on
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	return ln.Addr().String()
+}
+
+func TestRunMetricsListener(t *testing.T) {
+	r := router.New()
+	r.GET("/", func(ctx *fasthttp.RequestCtx) {})
+	rec := &closingRecorder{}
+	p := NewPrometheus("test_run_metrics_listener", WithBackend(rec), WithLifecycle(LifecycleConfig{DrainTimeout: time.Second}))
+	metricsAddr := freeAddr(t)
+	p.SetListenAddress(metricsAddr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Run(ctx, freeAddr(t), r)
+	}()
+
+	url := "http://" + metricsAddr + p.MetricsPath
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		code, _, err := fasthttp.Get(nil, url)
+		if err == nil && code == fasthttp.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("metrics not served on %s: %d %v", metricsAddr, code, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := fasthttp.Get(nil, url); err == nil {
+		t.Errorf("metrics still served on %s after Run returned", metricsAddr)
+	}
+	if !rec.closed.Load() {
+		t.Error("backend not closed by Run")
+	}
+}
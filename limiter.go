@@ -0,0 +1,130 @@
+package fasthttpprom
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// reasons of requests_rejected_total
+const (
+	reasonQueueFull    = "queue_full"
+	reasonQueueTimeout = "queue_timeout"
+)
+
+// ConcurrencyLimitConfig configures a ConcurrencyLimiter
+type ConcurrencyLimitConfig struct {
+	// Name of the limiter, the limiter label of its metrics
+	Name string
+	// MaxInFlight is the number of requests handled concurrently, at least 1
+	MaxInFlight int
+	// MaxQueue is the number of requests waiting for a slot, further requests are
+	// rejected right away
+	MaxQueue int
+	// QueueTimeout is the longest a request waits for a slot before it is rejected. It
+	// waits until a slot is free when zero.
+	QueueTimeout time.Duration
+}
+
+// ConcurrencyLimiter is a Limiter capping the requests handled concurrently, with a
+// bounded queue of waiting requests
+type ConcurrencyLimiter struct {
+	cfg         ConcurrencyLimitConfig
+	slots       chan struct{}
+	queued      atomic.Int64
+	utilization prometheus.Gauge
+	queueDepth  prometheus.Gauge
+	rejected    *prometheus.CounterVec
+}
+
+// NewConcurrencyLimiter returns a limiter for LimitHandler exporting the share of its
+// slots in use in concurrency_limit_utilization, the number of waiting requests in
+// concurrency_limit_queue_depth and the rejected requests in requests_rejected_total by
+// reason, queue_full or queue_timeout, all labeled with the name of the limiter
+func (p *Prometheus) NewConcurrencyLimiter(cfg ConcurrencyLimitConfig) *ConcurrencyLimiter {
+	if cfg.MaxInFlight < 1 {
+		cfg.MaxInFlight = 1
+	}
+	labels := []string{"limiter"}
+	utilization := registerCollector(prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: p.subsystem,
+			Name:      "concurrency_limit_utilization",
+			Help:      "share of the execution slots of the concurrency limiter in use",
+		},
+		labels,
+	)).(*prometheus.GaugeVec)
+	queueDepth := registerCollector(prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: p.subsystem,
+			Name:      "concurrency_limit_queue_depth",
+			Help:      "requests waiting for an execution slot of the concurrency limiter",
+		},
+		labels,
+	)).(*prometheus.GaugeVec)
+	rejected := registerCollector(prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: p.subsystem,
+			Name:      "requests_rejected_total",
+			Help:      "requests rejected by the concurrency limiter by reason",
+		},
+		[]string{"limiter", "reason"},
+	)).(*prometheus.CounterVec)
+
+	l := &ConcurrencyLimiter{
+		cfg:         cfg,
+		slots:       make(chan struct{}, cfg.MaxInFlight),
+		utilization: utilization.WithLabelValues(cfg.Name),
+		queueDepth:  queueDepth.WithLabelValues(cfg.Name),
+		rejected:    rejected.MustCurryWith(prometheus.Labels{"limiter": cfg.Name}),
+	}
+	l.rejected.WithLabelValues(reasonQueueFull)
+	l.rejected.WithLabelValues(reasonQueueTimeout)
+
+	return l
+}
+
+// Acquire implements Limiter
+func (l *ConcurrencyLimiter) Acquire(ctx *fasthttp.RequestCtx) (func(), bool) {
+	select {
+	case l.slots <- struct{}{}:
+		return l.acquired(), true
+	default:
+	}
+
+	if queued := l.queued.Add(1); queued > int64(l.cfg.MaxQueue) {
+		l.queued.Add(-1)
+		l.rejected.WithLabelValues(reasonQueueFull).Inc()
+		return nil, false
+	}
+	l.queueDepth.Set(float64(l.queued.Load()))
+	defer func() {
+		l.queueDepth.Set(float64(l.queued.Add(-1)))
+	}()
+
+	var timeout <-chan time.Time
+	if l.cfg.QueueTimeout > 0 {
+		timer := time.NewTimer(l.cfg.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return l.acquired(), true
+	case <-timeout:
+		l.rejected.WithLabelValues(reasonQueueTimeout).Inc()
+		return nil, false
+	}
+}
+
+// acquired records a taken slot, returning the func releasing it
+func (l *ConcurrencyLimiter) acquired() func() {
+	l.utilization.Set(float64(len(l.slots)) / float64(cap(l.slots)))
+
+	return func() {
+		<-l.slots
+		l.utilization.Set(float64(len(l.slots)) / float64(cap(l.slots)))
+	}
+}
@@ -0,0 +1,101 @@
+package fasthttpprom
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	p := NewPrometheus("test_concurrency_limiter")
+	defer p.Close()
+	l := p.NewConcurrencyLimiter(ConcurrencyLimitConfig{Name: "api", MaxInFlight: 1, MaxQueue: 1, QueueTimeout: 50 * time.Millisecond})
+	labels := func(reason string) map[string]string {
+		return map[string]string{"limiter": "api", "reason": reason}
+	}
+
+	release, ok := l.Acquire(&fasthttp.RequestCtx{})
+	if !ok {
+		t.Fatal("free slot not acquired")
+	}
+	if v, _ := metricValue(t, "test_concurrency_limiter_concurrency_limit_utilization", map[string]string{"limiter": "api"}); v != 1 {
+		t.Errorf("utilization = %v, want 1", v)
+	}
+
+	// the first waiting request times out, the one arriving meanwhile finds the queue full
+	timedOut := make(chan bool)
+	go func() {
+		_, ok := l.Acquire(&fasthttp.RequestCtx{})
+		timedOut <- !ok
+	}()
+	for l.queued.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, ok := l.Acquire(&fasthttp.RequestCtx{}); ok {
+		t.Error("slot acquired with a full queue")
+	}
+	if !<-timedOut {
+		t.Error("slot acquired while held")
+	}
+	for reason, want := range map[string]float64{reasonQueueFull: 1, reasonQueueTimeout: 1} {
+		if v, _ := metricValue(t, "test_concurrency_limiter_requests_rejected_total", labels(reason)); v != want {
+			t.Errorf("%s rejections = %v, want %v", reason, v, want)
+		}
+	}
+
+	release()
+	release, ok = l.Acquire(&fasthttp.RequestCtx{})
+	if !ok {
+		t.Fatal("released slot not acquired")
+	}
+	release()
+	if v, _ := metricValue(t, "test_concurrency_limiter_concurrency_limit_utilization", map[string]string{"limiter": "api"}); v != 0 {
+		t.Errorf("utilization once released = %v, want 0", v)
+	}
+}
+
+func TestLimitHandler(t *testing.T) {
+	p := NewPrometheus("test_limit_handler")
+	defer p.Close()
+	l := p.NewConcurrencyLimiter(ConcurrencyLimitConfig{Name: "api", MaxInFlight: 1})
+	release, _ := l.Acquire(&fasthttp.RequestCtx{})
+	h := p.LimitHandler(l, func(ctx *fasthttp.RequestCtx) { ctx.SetBodyString("ok") })
+
+	if ctx := serve(h, fasthttp.MethodGet, "/"); ctx.Response.StatusCode() != fasthttp.StatusServiceUnavailable {
+		t.Errorf("request without a slot answered %d, want 503", ctx.Response.StatusCode())
+	}
+	release()
+	if ctx := serve(h, fasthttp.MethodGet, "/"); string(ctx.Response.Body()) != "ok" {
+		t.Errorf("request with a slot answered %q", ctx.Response.Body())
+	}
+	for result, want := range map[string]float64{"rejected": 1, "acquired": 1} {
+		if v, _ := metricValue(t, "test_limit_handler_request_queue_duration_seconds", map[string]string{"result": result}); v != want {
+			t.Errorf("%s requests = %v, want %v", result, v, want)
+		}
+	}
+}
+
+func TestRateLimitRejectedMethodLabel(t *testing.T) {
+	r := router.New()
+	var p *Prometheus
+	r.ANY("/api", func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(fasthttp.StatusTooManyRequests)
+		p.ObserveRateLimit(ctx, RateLimitDecision{Limiter: "api", Rejected: true})
+	})
+	p = newTestPrometheus(t, "test_ratelimit_method_label", r)
+
+	for _, method := range []string{fasthttp.MethodPost, "JUNK1", "JUNK2"} {
+		serve(p.Handler, method, "/api")
+	}
+	for path, want := range map[string]float64{"POST_/api": 1, "other_/api": 2} {
+		v, _ := metricValue(t, "test_ratelimit_method_label_ratelimit_rejected_total", map[string]string{"limiter": "api", "path": path})
+		if v != want {
+			t.Errorf("ratelimit_rejected_total{path=%q} = %v, want %v", path, v, want)
+		}
+	}
+	if n := len(gatheredLabels(t, "test_ratelimit_method_label_ratelimit_rejected_total")); n != 2 {
+		t.Errorf("%d ratelimit_rejected_total series, want 2", n)
+	}
+}
@@ -0,0 +1,156 @@
+package fasthttpprom
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Listener wraps a net.Listener, recording the accepted connections, accept errors,
+// currently open connections and connection durations labeled by the listener name
+type Listener struct {
+	net.Listener
+	accepted prometheus.Counter
+	errors   prometheus.Counter
+	open     prometheus.Gauge
+	connDur  prometheus.Observer
+}
+
+// NewListener wraps ln, registering listener_accepted_connections_total,
+// listener_accept_errors_total, listener_open_connections and
+// listener_connection_duration_seconds under subsystem. name is the listener label, so
+// f.e the API and the metrics listener can be told apart.
+func NewListener(ln net.Listener, subsystem, name string) *Listener {
+	labels := []string{"listener"}
+	accepted := registerCollector(prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: subsystem,
+			Name:      "listener_accepted_connections_total",
+			Help:      "accepted connections",
+		},
+		labels,
+	)).(*prometheus.CounterVec)
+	acceptErrors := registerCollector(prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: subsystem,
+			Name:      "listener_accept_errors_total",
+			Help:      "failed accepts",
+		},
+		labels,
+	)).(*prometheus.CounterVec)
+	open := registerCollector(prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: subsystem,
+			Name:      "listener_open_connections",
+			Help:      "currently open accepted connections",
+		},
+		labels,
+	)).(*prometheus.GaugeVec)
+	connDur := registerCollector(prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: subsystem,
+			Name:      "listener_connection_duration_seconds",
+			Help:      "lifetimes of accepted connections",
+			Buckets:   prometheus.ExponentialBuckets(.01, 4, 10),
+		},
+		labels,
+	)).(*prometheus.HistogramVec)
+
+	return &Listener{
+		Listener: ln,
+		accepted: accepted.WithLabelValues(name),
+		errors:   acceptErrors.WithLabelValues(name),
+		open:     open.WithLabelValues(name),
+		connDur:  connDur.WithLabelValues(name),
+	}
+}
+
+// Accept waits for and returns the next connection, recording it until it is closed.
+// Errors after the listener is closed are not counted.
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		if !errors.Is(err, net.ErrClosed) {
+			l.errors.Inc()
+		}
+		return nil, err
+	}
+	l.accepted.Inc()
+	l.open.Inc()
+
+	return &listenerConn{Conn: c, l: l, start: time.Now()}, nil
+}
+
+// listenerConn records its lifetime when closed
+type listenerConn struct {
+	net.Conn
+	l         *Listener
+	start     time.Time
+	mu        sync.Mutex
+	onClose   []func()
+	closeOnce sync.Once
+	// onWriteError is called once when a write fails, f.e because the client went away
+	onWriteError func()
+}
+
+// notifyWriteError calls f when the next write fails, replacing the func registered for
+// the previous request on the connection
+func (c *listenerConn) notifyWriteError(f func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onWriteError = f
+}
+
+func (c *listenerConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if err != nil {
+		c.mu.Lock()
+		onWriteError := c.onWriteError
+		c.onWriteError = nil
+		c.mu.Unlock()
+		if onWriteError != nil {
+			onWriteError()
+		}
+	}
+
+	return n, err
+}
+
+func (c *listenerConn) notifyClose(f func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onClose = append(c.onClose, f)
+}
+
+func (c *listenerConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.l.open.Dec()
+		c.l.connDur.Observe(time.Since(c.start).Seconds())
+		c.mu.Lock()
+		onClose := c.onClose
+		c.mu.Unlock()
+		for _, f := range onClose {
+			f()
+		}
+	})
+
+	return c.Conn.Close()
+}
+
+// registerCollector registers c, returning the already registered collector when an
+// identical one exists so several instances share their metrics
+func registerCollector(c prometheus.Collector) prometheus.Collector {
+	if err := prometheus.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			return are.ExistingCollector
+		}
+	}
+
+	return c
+}
@@ -0,0 +1,63 @@
+package fasthttpprom
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// WithMaintenanceMode exports the maintenance mode set with SetMaintenance in the
+// maintenance_mode gauge
+func WithMaintenanceMode() Option {
+	return func(p *Prometheus) {
+		p.maintenanceMetric = true
+	}
+}
+
+func (p *Prometheus) registerMaintenance(subsystem string) {
+	p.maintenanceMode = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Subsystem: subsystem,
+			Name:      "maintenance_mode",
+			Help:      "whether the application is in maintenance mode",
+		},
+	)
+	prometheus.Register(p.maintenanceMode)
+}
+
+// SetMaintenance flags planned work, exported with WithMaintenanceMode in
+// maintenance_mode, so alerts can be inhibited with f.e
+// unless on() (maintenance_mode == 1)
+func (p *Prometheus) SetMaintenance(on bool) {
+	p.maintenance.Store(on)
+	if p.maintenanceMode == nil {
+		return
+	}
+	if on {
+		p.maintenanceMode.Set(1)
+		return
+	}
+	p.maintenanceMode.Set(0)
+}
+
+// Maintenance reports whether the application is in maintenance mode
+func (p *Prometheus) Maintenance() bool {
+	return p.maintenance.Load()
+}
+
+// MaintenanceHandler answers the maintenance mode, "true" or "false", and sets it from
+// the enabled argument of PUT and POST requests, f.e for an admin endpoint
+func (p *Prometheus) MaintenanceHandler() fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if ctx.IsPut() || ctx.IsPost() {
+			on, err := strconv.ParseBool(string(ctx.FormValue("enabled")))
+			if err != nil {
+				ctx.Error("invalid enabled argument", fasthttp.StatusBadRequest)
+				return
+			}
+			p.SetMaintenance(on)
+		}
+		ctx.SetBodyString(strconv.FormatBool(p.Maintenance()))
+	}
+}
@@ -0,0 +1,93 @@
+package fasthttpprom
+
+import (
+	"log"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultDurationMetric is the name of the histogram recording the requests
+const defaultDurationMetric = "request_duration_seconds"
+
+// WithMethodBuckets records the requests with the method label method, f.e "POST", with
+// buckets instead of the configured ones, f.e coarse buckets for uploads next to fine
+// ones for reads. Since the series of a metric share its buckets, they are recorded in
+// a histogram of their own named after the method, f.e request_duration_post_seconds.
+func WithMethodBuckets(method string, buckets []float64) Option {
+	return func(p *Prometheus) {
+		if p.methodBuckets == nil {
+			p.methodBuckets = make(map[string][]float64)
+		}
+		p.methodBuckets[method] = buckets
+	}
+}
+
+// methodMetricName returns the name of the histogram of the requests of method with
+// their own buckets, the method lower-cased with invalid characters replaced
+func methodMetricName(method string) string {
+	name := []byte(strings.ToLower(method))
+	for i, c := range name {
+		if !('a' <= c && c <= 'z') && !('0' <= c && c <= '9') {
+			name[i] = '_'
+		}
+	}
+
+	return "request_duration_" + string(name) + "_seconds"
+}
+
+func (p *Prometheus) registerMethodHistograms(subsystem string) {
+	p.methodReqDur = make(map[string]*prometheus.HistogramVec, len(p.methodBuckets))
+	for method, buckets := range p.methodBuckets {
+		vec := prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Subsystem: subsystem,
+				Name:      methodMetricName(method),
+				Help:      "request latencies of " + method + " requests",
+				Buckets:   buckets,
+			},
+			p.labelNames(),
+		)
+		if err := prometheus.Register(vec); err != nil {
+			log.Printf("Fail to register the histogram of %s requests: %s\n", method, err)
+			continue
+		}
+		p.methodReqDur[method] = vec
+	}
+}
+
+// durationMetric returns the name of the histogram recording the requests of method
+func (p *Prometheus) durationMetric(method string) string {
+	if _, ok := p.methodReqDur[method]; ok {
+		return methodMetricName(method)
+	}
+
+	return defaultDurationMetric
+}
+
+// histogramOf returns the histogram recording the requests of the method label method
+func (p *Prometheus) histogramOf(method string) *prometheus.HistogramVec {
+	if vec, ok := p.methodReqDur[method]; ok {
+		return vec
+	}
+
+	return p.reqDur
+}
+
+// bucketsOf returns the buckets of the histogram recording the requests of method
+func (p *Prometheus) bucketsOf(method string) []float64 {
+	if _, ok := p.methodReqDur[method]; ok {
+		return p.methodBuckets[method]
+	}
+
+	return p.buckets
+}
+
+// deleteSeries deletes the request duration series with the label values values
+func (p *Prometheus) deleteSeries(values ...string) {
+	if !p.reqDur.DeleteLabelValues(values...) {
+		for _, vec := range p.methodReqDur {
+			vec.DeleteLabelValues(values...)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package fasthttpprom
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+func TestMethodBuckets(t *testing.T) {
+	r := router.New()
+	r.GET("/files", func(ctx *fasthttp.RequestCtx) {})
+	r.POST("/files", func(ctx *fasthttp.RequestCtx) {})
+	p := newTestPrometheus(t, "test_method_buckets", r, WithMethodBuckets(fasthttp.MethodPost, []float64{1.75, 15}))
+
+	serve(p.Handler, fasthttp.MethodGet, "/files")
+	serve(p.Handler, fasthttp.MethodPost, "/files")
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gathering with method buckets: %s", err)
+	}
+	buckets := map[string]int{}
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), "test_method_buckets_request_duration") {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, pair := range m.GetLabel() {
+				if pair.GetName() == "path" {
+					buckets[family.GetName()+" "+pair.GetValue()] = len(m.GetHistogram().GetBucket())
+				}
+			}
+		}
+	}
+	want := map[string]int{
+		"test_method_buckets_request_duration_seconds GET_/files":       len(DefaultBuckets),
+		"test_method_buckets_request_duration_post_seconds POST_/files": 2,
+	}
+	if len(buckets) != len(want) {
+		t.Errorf("series %v, want %v", buckets, want)
+	}
+	for series, n := range want {
+		if buckets[series] != n {
+			t.Errorf("%s has %d buckets, want %d", series, buckets[series], n)
+		}
+	}
+}
+
+func TestMethodBucketsRules(t *testing.T) {
+	r := router.New()
+	r.GET("/files", func(ctx *fasthttp.RequestCtx) {})
+	r.POST("/files", func(ctx *fasthttp.RequestCtx) {})
+	p := newTestPrometheus(t, "test_method_buckets_rules", r, WithMethodBuckets(fasthttp.MethodPost, []float64{1.75, 15}))
+	cfg := RulesConfig{SLO: SLO{Availability: 0.999, Latency: 1750 * time.Millisecond, LatencyTarget: 0.99}}
+
+	if _, err := p.AlertingRules(cfg); err == nil {
+		t.Error("alerting rules generated for a latency objective which is not a bucket of GET requests")
+	}
+	cfg.Routes = map[string]SLO{"GET_/files": {Availability: 0.999}}
+	alerts, err := p.AlertingRules(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(alerts), `test_method_buckets_rules_request_duration_post_seconds_bucket{path=\"POST_/files\",le=\"1.75\"}`) {
+		t.Errorf("latency alert of POST_/files does not use its histogram:\n%s", alerts)
+	}
+	recording, err := p.RecordingRules(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(recording), `{__name__=~\"test_method_buckets_rules_request_duration_seconds_count|test_method_buckets_rules_request_duration_post_seconds_count\"}`) {
+		t.Errorf("recording rules do not select both histograms:\n%s", recording)
+	}
+}
@@ -0,0 +1,99 @@
+package fasthttpprom
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultMigrationName is the name of the histogram with the split labels
+const defaultMigrationName = "request_duration_v2_seconds"
+
+// MigrationConfig configures the transition from request_duration_seconds, labeled with
+// the concatenated method and path, f.e path="GET_/health", to a histogram with separate
+// method and path labels, f.e method="GET",path="/health"
+type MigrationConfig struct {
+	// Name of the new histogram, request_duration_v2_seconds if empty. It has to differ
+	// from request_duration_seconds since the labels differ.
+	Name string
+	// Period during which both histograms are written, after which the old one is
+	// unregistered. Both are written until the process exits when it is zero.
+	Period time.Duration
+}
+
+// WithLabelMigration writes every observation to a second histogram with split method and
+// path labels in addition to request_duration_seconds for cfg.Period, so dashboards and
+// alerts can be migrated before the old series disappear
+func WithLabelMigration(cfg MigrationConfig) Option {
+	return func(p *Prometheus) {
+		if cfg.Name == "" {
+			cfg.Name = defaultMigrationName
+		}
+		p.migration = &migration{cfg: cfg}
+	}
+}
+
+// migration writes the histogram with split labels and retires the old one
+type migration struct {
+	cfg        MigrationConfig
+	reqDur     *prometheus.HistogramVec
+	deadline   time.Time
+	retireOnce sync.Once
+}
+
+func (p *Prometheus) registerMigration(subsystem string) {
+	names := append([]string{"code", "method", "path"}, p.labelNames()[2:]...)
+	p.migration.reqDur = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: subsystem,
+			Name:      p.migration.cfg.Name,
+			Help:      "request latencies",
+			Buckets:   p.buckets,
+		},
+		names,
+	)
+	prometheus.Register(p.migration.reqDur)
+	if p.migration.cfg.Period > 0 {
+		p.migration.deadline = p.clock.Now().Add(p.migration.cfg.Period)
+	}
+}
+
+// retired reports whether the migration period ended at now, unregistering the old
+// histograms the first time
+func (p *Prometheus) retired(now time.Time) bool {
+	m := p.migration
+	if m == nil || m.deadline.IsZero() || now.Before(m.deadline) {
+		return false
+	}
+	m.retireOnce.Do(func() {
+		p.unregister(p.reqDur)
+		for _, vec := range p.methodReqDur {
+			p.unregister(vec)
+		}
+	})
+
+	return true
+}
+
+// migrationBackend records into the histogram with split labels
+type migrationBackend struct {
+	p *Prometheus
+}
+
+func (b migrationBackend) Record(o Observation) {
+	values := []string{o.Code, o.Method, o.Route()}
+	for _, source := range b.p.labelSources {
+		values = append(values, o.Labels[source.name])
+	}
+	ob, err := b.p.migration.reqDur.GetMetricWithLabelValues(values...)
+	if err != nil {
+		b.p.instrumentationError(reasonLabelValues, err)
+		return
+	}
+	if eo, ok := ob.(prometheus.ExemplarObserver); ok && o.Exemplar != nil {
+		promBackend{b.p}.observeWithExemplar(eo, o)
+		return
+	}
+	ob.Observe(o.Duration.Seconds())
+}
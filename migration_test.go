@@ -0,0 +1,46 @@
+package fasthttpprom
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+func TestLabelMigration(t *testing.T) {
+	for name, tc := range map[string]struct {
+		period time.Duration
+		// whether request_duration_seconds is retired once the period passed
+		retired bool
+	}{
+		"period":  {period: 50 * time.Millisecond, retired: true},
+		"forever": {},
+	} {
+		t.Run(name, func(t *testing.T) {
+			subsystem := "test_label_migration_" + name
+			r := router.New()
+			r.GET("/users/{id}", func(ctx *fasthttp.RequestCtx) {})
+			p := newTestPrometheus(t, subsystem, r, WithLabelMigration(MigrationConfig{Period: tc.period}))
+
+			serve(p.Handler, fasthttp.MethodGet, "/users/1")
+			split := map[string]string{"method": "GET", "path": "/users/{id}", "code": "200"}
+			if v, _ := metricValue(t, subsystem+"_request_duration_v2_seconds", split); v != 1 {
+				t.Errorf("requests with split labels = %v, want 1", v)
+			}
+			if v, _ := metricValue(t, subsystem+"_request_duration_seconds", map[string]string{"path": "GET_/users/{id}"}); v != 1 {
+				t.Errorf("requests with the concatenated label = %v, want 1", v)
+			}
+
+			time.Sleep(2 * tc.period)
+			serve(p.Handler, fasthttp.MethodGet, "/users/2")
+			if v, _ := metricValue(t, subsystem+"_request_duration_v2_seconds", split); v != 2 {
+				t.Errorf("requests with split labels = %v, want 2", v)
+			}
+			_, exported := metricValue(t, subsystem+"_request_duration_seconds", map[string]string{"path": "GET_/users/{id}"})
+			if exported == tc.retired {
+				t.Errorf("request_duration_seconds exported = %v after the period", exported)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package fasthttpprom
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Placeholders substituted for variable path segments by PathNormalizer
+const (
+	NumberPlaceholder = ":num"
+	UUIDPlaceholder   = ":uuid"
+	HashPlaceholder   = ":hash"
+)
+
+// minHashLen is the shortest hex segment treated as a hash
+const minHashLen = 16
+
+// PathRule rewrites every match of Pattern in a path with Replacement
+type PathRule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// PathNormalizer collapses the variable segments of request paths which did not match any
+// route, so unmatched traffic is aggregated into a handful of label values
+type PathNormalizer struct {
+	// CollapseNumbers replaces decimal segments such as /users/123 with :num
+	CollapseNumbers bool
+	// CollapseUUIDs replaces UUID segments with :uuid
+	CollapseUUIDs bool
+	// CollapseHashes replaces hex segments of at least 16 characters with :hash
+	CollapseHashes bool
+	// Rules are applied in order to the whole path after the segments are collapsed
+	Rules []PathRule
+}
+
+// DefaultPathNormalizer collapses numeric, UUID and hash segments
+func DefaultPathNormalizer() *PathNormalizer {
+	return &PathNormalizer{
+		CollapseNumbers: true,
+		CollapseUUIDs:   true,
+		CollapseHashes:  true,
+	}
+}
+
+// Normalize returns path with its variable segments replaced by placeholders
+func (n *PathNormalizer) Normalize(path string) string {
+	if n.CollapseNumbers || n.CollapseUUIDs || n.CollapseHashes {
+		segments := strings.Split(path, "/")
+		for i, seg := range segments {
+			switch {
+			case seg == "":
+			case n.CollapseNumbers && isNumber(seg):
+				segments[i] = NumberPlaceholder
+			case n.CollapseUUIDs && isUUID(seg):
+				segments[i] = UUIDPlaceholder
+			case n.CollapseHashes && isHash(seg):
+				segments[i] = HashPlaceholder
+			}
+		}
+		path = strings.Join(segments, "/")
+	}
+	for _, rule := range n.Rules {
+		path = rule.Pattern.ReplaceAllString(path, rule.Replacement)
+	}
+
+	return path
+}
+
+func isNumber(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			if !isHex(s[i]) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func isHash(s string) bool {
+	if len(s) < minHashLen {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isHex(s[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
@@ -0,0 +1,144 @@
+package fasthttpprom
+
+import (
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Option configures a Prometheus instance at construction time
+type Option func(*Prometheus)
+
+// WithCoarseClock timestamps requests with a clock that is refreshed by a ticker every
+// resolution instead of calling time.Now twice per request. Durations are only accurate
+// to resolution, so this is meant for very high QPS services where the clock reads show
+// up in profiles. Call Close to stop the ticker.
+func WithCoarseClock(resolution time.Duration) Option {
+	return func(p *Prometheus) {
+		if resolution <= 0 {
+			return
+		}
+		p.clock = newCoarseClock(resolution)
+	}
+}
+
+// WithMaxSeries caps the number of live label combinations. Once the cap is exceeded the
+// least recently observed series is deleted and series_evictions_total is incremented.
+func WithMaxSeries(max int) Option {
+	return func(p *Prometheus) {
+		p.maxSeries = max
+	}
+}
+
+// WithSeriesTTL deletes series which have not been observed for ttl, so removed endpoints
+// and one-off scanner paths eventually disappear from scrapes. Call Close to stop the
+// expiry goroutine.
+func WithSeriesTTL(ttl time.Duration) Option {
+	return func(p *Prometheus) {
+		p.seriesTTL = ttl
+	}
+}
+
+// WithMaxPathLabels caps the number of distinct path label values. Requests beyond the
+// cap are recorded under path="overflow" and counted in label_overflow_total.
+func WithMaxPathLabels(max int) Option {
+	return func(p *Prometheus) {
+		p.maxPaths = max
+	}
+}
+
+// WithPathNormalizer labels requests which did not match any route with their path
+// rewritten by n instead of the raw request path, including 404 responses
+func WithPathNormalizer(n *PathNormalizer) Option {
+	return func(p *Prometheus) {
+		p.normalizer = n
+	}
+}
+
+// WithMaxLabelLength truncates path label values longer than max bytes, marking the cut
+// with "...", so absurdly long URLs from attack traffic don't bloat the exposition
+func WithMaxLabelLength(max int) Option {
+	return func(p *Prometheus) {
+		p.maxLabelLength = max
+	}
+}
+
+// WithRouteCache keeps the route patterns resolved for up to size method and path pairs
+// in an LRU cache, counting hits and misses in route_cache_lookups_total
+func WithRouteCache(size int) Option {
+	return func(p *Prometheus) {
+		p.routeCacheSize = size
+	}
+}
+
+// WithListenerMetrics records the connections of the separate metrics server started by
+// SetListenAddress through NewListener, labeled listener="metrics"
+func WithListenerMetrics() Option {
+	return func(p *Prometheus) {
+		p.listenerMetrics = true
+	}
+}
+
+// WithRecoverPanics recovers the panics of handlers when the router has no PanicHandler,
+// logging them and answering 500 Internal Server Error, since fasthttp itself does not
+// recover them. The requests are recorded as 500s either way.
+func WithRecoverPanics() Option {
+	return func(p *Prometheus) {
+		p.recoverPanics = true
+	}
+}
+
+// WithFallback sets the path label of requests whose route could not be resolved, f.e
+// because the route was removed. By default the request path is recorded.
+func WithFallback(mode FallbackMode) Option {
+	return func(p *Prometheus) {
+		p.fallback = mode
+	}
+}
+
+// unsetStatusCode is set on the response before calling the handler with
+// WithUnsetStatusLabel, to tell whether the handler set a status code
+const unsetStatusCode = 999
+
+// unsetStatus is the code label of requests whose handler never set a status code
+const unsetStatus = "unset"
+
+// WithUnsetStatusLabel records requests whose handler never set a status code as
+// code="unset" instead of 200, for debugging misbehaving handlers. The response status
+// reads as 999 inside handlers until they set one, and is sent as 200.
+func WithUnsetStatusLabel() Option {
+	return func(p *Prometheus) {
+		p.markUnsetStatus = true
+	}
+}
+
+// WithMetricsPathMatcher replaces the comparison of the request path with MetricsPath
+// which excludes scrapes from instrumentation, f.e when the router is mounted under a
+// group prefix or behind a path rewriting proxy
+func WithMetricsPathMatcher(match func(ctx *fasthttp.RequestCtx) bool) Option {
+	return func(p *Prometheus) {
+		p.metricsMatcher = match
+	}
+}
+
+// WithSkipStatusCodes does not record requests answered with one of codes, f.e 101 or
+// 304, counting them in skipped_requests_total by code instead
+func WithSkipStatusCodes(codes ...int) Option {
+	return func(p *Prometheus) {
+		if p.skipCodes == nil {
+			p.skipCodes = make(map[int]bool, len(codes))
+		}
+		for _, code := range codes {
+			p.skipCodes[code] = true
+		}
+	}
+}
+
+// WithStatusMapper records the code label of requests as mapped by fn from their status
+// code instead of the number, f.e to record 429 as "throttled" or group 5xx codes. The
+// path label is still resolved from the status code.
+func WithStatusMapper(fn func(code int) string) Option {
+	return func(p *Prometheus) {
+		p.statusMapper = fn
+	}
+}
@@ -0,0 +1,37 @@
+package otel
+
+import (
+	"context"
+
+	fasthttpprom "github.com/carousell/fasthttp-prometheus-middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanExemplar returns an extractor attaching the trace and span IDs of the active span as
+// trace_id and span_id exemplar labels. contextOf returns the context the application's
+// tracing middleware stored the span in; the request itself is used when it is nil, which
+// works when the span is stored as a request user value.
+//
+//	p := fasthttpprom.NewPrometheus("", fasthttpprom.WithExemplars(
+//		otel.SpanExemplar(nil),
+//		fasthttpprom.TraceparentExemplar,
+//	))
+func SpanExemplar(contextOf func(ctx *fasthttp.RequestCtx) context.Context) fasthttpprom.ExemplarExtractor {
+	return func(ctx *fasthttp.RequestCtx) prometheus.Labels {
+		var c context.Context = ctx
+		if contextOf != nil {
+			c = contextOf(ctx)
+		}
+		sc := trace.SpanContextFromContext(c)
+		if !sc.IsValid() {
+			return nil
+		}
+
+		return prometheus.Labels{
+			"trace_id": sc.TraceID().String(),
+			"span_id":  sc.SpanID().String(),
+		}
+	}
+}
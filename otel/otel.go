@@ -0,0 +1,61 @@
+// Package otel records the middleware's request metrics through the OpenTelemetry metrics
+// API, so teams moving to an OpenTelemetry collector pipeline keep the same metric names
+// and labels.
+//
+// The meter provider is configured by the application, f.e with the SDK and an OTLP/gRPC
+// or OTLP/HTTP exporter:
+//
+//	exporter, _ := otlpmetricgrpc.New(ctx)
+//	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)))
+//	backend, _ := otel.New(provider, "")
+//	p := fasthttpprom.NewPrometheus("", fasthttpprom.WithBackend(backend))
+//
+// Register a view with fasthttpprom.DefaultBuckets as explicit bucket boundaries on the
+// provider to keep the Prometheus histogram buckets.
+package otel
+
+import (
+	"context"
+
+	fasthttpprom "github.com/carousell/fasthttp-prometheus-middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const instrumentationName = "github.com/carousell/fasthttp-prometheus-middleware/otel"
+
+// Backend records request observations as an OpenTelemetry histogram
+type Backend struct {
+	reqDur metric.Float64Histogram
+}
+
+// New creates the request duration histogram on a meter of provider. subsystem prefixes
+// the instrument name the same way it prefixes the Prometheus metric name.
+func New(provider metric.MeterProvider, subsystem string) (*Backend, error) {
+	name := "request_duration_seconds"
+	if subsystem != "" {
+		name = subsystem + "_" + name
+	}
+	reqDur, err := provider.Meter(instrumentationName).Float64Histogram(
+		name,
+		metric.WithDescription("request latencies"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Backend{reqDur: reqDur}, nil
+}
+
+// Record implements fasthttpprom.MetricsBackend
+func (b *Backend) Record(o fasthttpprom.Observation) {
+	attrs := []attribute.KeyValue{
+		attribute.String("code", o.Code),
+		attribute.String("path", o.Path),
+	}
+	for name, value := range o.Labels {
+		attrs = append(attrs, attribute.String(name, value))
+	}
+	b.reqDur.Record(context.Background(), o.Duration.Seconds(), metric.WithAttributes(attrs...))
+}
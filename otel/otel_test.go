@@ -0,0 +1,91 @@
+package otel
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	fasthttpprom "github.com/carousell/fasthttp-prometheus-middleware"
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// measurement is a value recorded to a histogram with its attributes
+type measurement struct {
+	value float64
+	attrs attribute.Set
+}
+
+// fakeHistogram keeps the recorded measurements
+type fakeHistogram struct {
+	noop.Float64Histogram
+	mu           sync.Mutex
+	measurements []measurement
+}
+
+func (h *fakeHistogram) Record(ctx context.Context, value float64, opts ...metric.RecordOption) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.measurements = append(h.measurements, measurement{value, metric.NewRecordConfig(opts).Attributes()})
+}
+
+// fakeProvider hands out meters creating fakeHistograms by name
+type fakeProvider struct {
+	noop.MeterProvider
+	histograms map[string]*fakeHistogram
+}
+
+func (p *fakeProvider) Meter(name string, opts ...metric.MeterOption) metric.Meter {
+	return &fakeMeter{provider: p}
+}
+
+type fakeMeter struct {
+	noop.Meter
+	provider *fakeProvider
+}
+
+func (m *fakeMeter) Float64Histogram(name string, opts ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	h := &fakeHistogram{}
+	m.provider.histograms[name] = h
+	return h, nil
+}
+
+func TestBackend(t *testing.T) {
+	provider := &fakeProvider{histograms: make(map[string]*fakeHistogram)}
+	b, err := New(provider, "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := router.New()
+	r.GET("/users/{id}", func(ctx *fasthttp.RequestCtx) {})
+	p := fasthttpprom.NewPrometheus("test_otel_backend", fasthttpprom.WithOnlyBackend(b))
+	defer p.Close()
+	if err := p.Use(r); err != nil {
+		t.Fatal(err)
+	}
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/users/1")
+	p.Handler(ctx)
+
+	h, ok := provider.histograms["api_request_duration_seconds"]
+	if !ok {
+		t.Fatalf("histograms %v, want api_request_duration_seconds", provider.histograms)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.measurements) != 1 {
+		t.Fatalf("%d measurements recorded, want 1", len(h.measurements))
+	}
+	m := h.measurements[0]
+	want := attribute.NewSet(attribute.String("code", "200"), attribute.String("path", "GET_/users/{id}"))
+	if !m.attrs.Equals(&want) {
+		t.Errorf("attributes %v, want %v", m.attrs.ToSlice(), want.ToSlice())
+	}
+	if m.value < 0 {
+		t.Errorf("recorded %v seconds", m.value)
+	}
+}
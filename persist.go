@@ -0,0 +1,309 @@
+package fasthttpprom
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// defaultPersistInterval is the interval between snapshots of the persisted metrics
+const defaultPersistInterval = time.Minute
+
+// PersistenceConfig configures persisting the counters of the middleware across restarts
+type PersistenceConfig struct {
+	// Path of the snapshot file, replaced atomically by renaming a temporary file
+	Path string
+	// Interval between snapshots, 1m if zero. A final snapshot is taken on Close.
+	Interval time.Duration
+}
+
+// WithPersistence snapshots the counters and histograms of the middleware to cfg.Path
+// every cfg.Interval and on Close, and restores them from it on startup, for
+// environments with scrapes so infrequent that restarts lose meaningful data. The
+// increments since the last snapshot are lost on a crash. Since client_golang exposes no
+// _created samples, the restored values are not mistaken for counts since the restart.
+// The time counting originally started is kept in the snapshot and exported in
+// counters_created_timestamp_seconds instead.
+func WithPersistence(cfg PersistenceConfig) Option {
+	return func(p *Prometheus) {
+		if cfg.Interval <= 0 {
+			cfg.Interval = defaultPersistInterval
+		}
+		p.persistence = &persistence{cfg: cfg}
+	}
+}
+
+// persistence holds the persisted metrics and the time counting started
+type persistence struct {
+	cfg      PersistenceConfig
+	created  time.Time
+	registry *prometheus.Registry
+	// restored holds the collectors registered in place of the persisted metrics
+	restored map[prometheus.Collector]*restoredCollector
+}
+
+// persistedSnapshot is the content of the snapshot file
+type persistedSnapshot struct {
+	Created time.Time                    `json:"created"`
+	Metrics map[string][]persistedSeries `json:"metrics"`
+}
+
+// persistedSeries is the value of a counter or histogram series
+type persistedSeries struct {
+	Labels  map[string]string `json:"labels,omitempty"`
+	Value   float64           `json:"value,omitempty"`
+	Count   uint64            `json:"count,omitempty"`
+	Sum     float64           `json:"sum,omitempty"`
+	Buckets []uint64          `json:"buckets,omitempty"`
+}
+
+// persistedMetrics returns the counters and histograms of p by metric name
+func (p *Prometheus) persistedMetrics() map[string]prometheus.Collector {
+	metrics := make(map[string]prometheus.Collector)
+	vecs := map[string]*prometheus.CounterVec{
+		"websocket_upgrades_total":       p.websocketUpgrades,
+		"stream_bytes_total":             p.streamBytes,
+		"ratelimit_rejected_total":       p.rateLimitRejections,
+		"trailing_slash_redirects_total": p.tsrRedirects,
+		"client_disconnects_total":       p.clientDisconnects,
+		"handler_errors_total":           p.handlerErrors,
+		"skipped_requests_total":         p.skippedRequests,
+		"instrumentation_errors_total":   p.instrumentationErrors,
+		"anomalous_durations_total":      p.anomalousDurations,
+		"automated_requests_total":       p.automatedRequests,
+	}
+	for name, vec := range vecs {
+		if vec != nil {
+			metrics[name] = vec
+		}
+	}
+	histograms := map[string]*prometheus.HistogramVec{
+		"request_duration_seconds":            p.reqDur,
+		"stream_duration_seconds":             p.streamDur,
+		"ratelimit_decision_duration_seconds": p.rateLimitDur,
+		"redirect_duration_seconds":           p.redirectDur,
+	}
+	for name, vec := range histograms {
+		if vec != nil {
+			metrics[name] = vec
+		}
+	}
+	for method, vec := range p.methodReqDur {
+		metrics[methodMetricName(method)] = vec
+	}
+	if p.seriesEvictions != nil {
+		metrics["series_evictions_total"] = p.seriesEvictions
+	}
+	if p.labelOverflows != nil {
+		metrics["label_overflow_total"] = p.labelOverflows
+	}
+
+	return metrics
+}
+
+// startPersistence restores the snapshot, replaces the registered metrics with ones
+// adding the restored values and schedules the snapshots
+func (p *Prometheus) startPersistence(subsystem string) {
+	snapshot, err := readSnapshot(p.persistence.cfg.Path)
+	if err != nil {
+		log.Printf("Fail to restore persisted metrics: %s\n", err)
+	}
+	p.persistence.created = p.clock.Now()
+	if !snapshot.Created.IsZero() {
+		p.persistence.created = snapshot.Created
+	}
+
+	p.persistence.registry = prometheus.NewRegistry()
+	p.persistence.restored = make(map[prometheus.Collector]*restoredCollector)
+	for name, c := range p.persistedMetrics() {
+		fqName := prometheus.BuildFQName("", subsystem, name)
+		restored := newRestoredCollector(c, snapshot.Metrics[fqName])
+		prometheus.Unregister(c)
+		prometheus.Register(restored)
+		p.persistence.registry.Register(restored)
+		p.persistence.restored[c] = restored
+	}
+	prometheus.Register(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Subsystem: subsystem,
+			Name:      "counters_created_timestamp_seconds",
+			Help:      "time the persisted counters started counting",
+		},
+		func() float64 { return float64(p.persistence.created.UnixNano()) / 1e9 },
+	))
+
+	persist := func() {
+		if err := p.persist(); err != nil {
+			log.Printf("Fail to persist metrics: %s\n", err)
+		}
+	}
+	p.runEvery(p.persistence.cfg.Interval, 0, persist, persist)
+}
+
+// unregister unregisters the metric c, or the collector restoring its persisted values,
+// which is no longer persisted either
+func (p *Prometheus) unregister(c prometheus.Collector) {
+	if p.persistence != nil {
+		if restored, ok := p.persistence.restored[c]; ok {
+			p.persistence.registry.Unregister(restored)
+			c = restored
+		}
+	}
+	prometheus.Unregister(c)
+}
+
+// readSnapshot reads the snapshot at path, which is empty when the file does not exist
+func readSnapshot(path string) (persistedSnapshot, error) {
+	var snapshot persistedSnapshot
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return snapshot, nil
+	}
+	if err != nil {
+		return snapshot, err
+	}
+	err = json.Unmarshal(b, &snapshot)
+
+	return snapshot, err
+}
+
+// persist writes the current values of the persisted metrics to the snapshot file
+func (p *Prometheus) persist() error {
+	families, err := p.persistence.registry.Gather()
+	if err != nil {
+		return err
+	}
+	snapshot := persistedSnapshot{Created: p.persistence.created, Metrics: make(map[string][]persistedSeries)}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			s := persistedSeries{Labels: make(map[string]string)}
+			for _, pair := range m.GetLabel() {
+				s.Labels[pair.GetName()] = pair.GetValue()
+			}
+			if h := m.GetHistogram(); h != nil {
+				s.Count = h.GetSampleCount()
+				s.Sum = h.GetSampleSum()
+				for _, bucket := range h.GetBucket() {
+					s.Buckets = append(s.Buckets, bucket.GetCumulativeCount())
+				}
+			} else {
+				s.Value = m.GetCounter().GetValue()
+			}
+			snapshot.Metrics[family.GetName()] = append(snapshot.Metrics[family.GetName()], s)
+		}
+	}
+	b, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	path := p.persistence.cfg.Path
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// restoredCollector adds the restored values to the series of a collector
+type restoredCollector struct {
+	prometheus.Collector
+	offsets map[string]persistedSeries
+}
+
+func newRestoredCollector(c prometheus.Collector, series []persistedSeries) *restoredCollector {
+	rc := &restoredCollector{Collector: c, offsets: make(map[string]persistedSeries)}
+	for _, s := range series {
+		// create the series so the restored values are exported before they change
+		var err error
+		switch vec := c.(type) {
+		case *prometheus.CounterVec:
+			_, err = vec.GetMetricWith(s.Labels)
+		case *prometheus.HistogramVec:
+			_, err = vec.GetMetricWith(s.Labels)
+		}
+		if err != nil {
+			log.Printf("Fail to restore persisted series: %s\n", err)
+			continue
+		}
+		rc.offsets[seriesKey(s.Labels)] = s
+	}
+
+	return rc
+}
+
+// Collect implements prometheus.Collector
+func (rc *restoredCollector) Collect(ch chan<- prometheus.Metric) {
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		rc.Collector.Collect(metrics)
+		close(metrics)
+	}()
+	for m := range metrics {
+		ch <- restoredMetric{Metric: m, rc: rc}
+	}
+}
+
+// restoredMetric adds the restored values of its series to a metric
+type restoredMetric struct {
+	prometheus.Metric
+	rc *restoredCollector
+}
+
+// Write implements prometheus.Metric
+func (m restoredMetric) Write(out *dto.Metric) error {
+	if err := m.Metric.Write(out); err != nil {
+		return err
+	}
+	labels := make(map[string]string, len(out.GetLabel()))
+	for _, pair := range out.GetLabel() {
+		labels[pair.GetName()] = pair.GetValue()
+	}
+	offset, ok := m.rc.offsets[seriesKey(labels)]
+	if !ok {
+		return nil
+	}
+	if c := out.GetCounter(); c != nil {
+		c.Value = proto.Float64(c.GetValue() + offset.Value)
+	}
+	// histograms whose buckets changed since the snapshot are not restored
+	if h := out.GetHistogram(); h != nil && len(h.GetBucket()) == len(offset.Buckets) {
+		h.SampleCount = proto.Uint64(h.GetSampleCount() + offset.Count)
+		h.SampleSum = proto.Float64(h.GetSampleSum() + offset.Sum)
+		for i, bucket := range h.GetBucket() {
+			bucket.CumulativeCount = proto.Uint64(bucket.GetCumulativeCount() + offset.Buckets[i])
+		}
+	}
+
+	return nil
+}
+
+// seriesKey identifies the series with labels
+func seriesKey(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, "\xff")
+}
@@ -0,0 +1,90 @@
+package fasthttpprom
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// newPersistedRouter returns a router with GET and POST routes on /files
+func newPersistedRouter() *router.Router {
+	r := router.New()
+	r.GET("/files", func(ctx *fasthttp.RequestCtx) {})
+	r.POST("/files", func(ctx *fasthttp.RequestCtx) {})
+
+	return r
+}
+
+func TestPersistenceRestores(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	opts := []Option{
+		WithPersistence(PersistenceConfig{Path: path, Interval: time.Hour}),
+		WithMethodBuckets(fasthttp.MethodPost, []float64{1.75, 15}),
+	}
+	get := map[string]string{"path": "GET_/files"}
+	post := map[string]string{"path": "POST_/files"}
+
+	// the first process records a request of each method and snapshots them on Close
+	p := NewPrometheus("test_persistence", opts...)
+	if err := p.Use(newPersistedRouter()); err != nil {
+		t.Fatal(err)
+	}
+	serve(p.Handler, fasthttp.MethodGet, "/files")
+	serve(p.Handler, fasthttp.MethodPost, "/files")
+	p.Close()
+	// the process exits, its histograms go away with the default registry
+	prometheus.Unregister(p.reqDur)
+	for _, vec := range p.methodReqDur {
+		prometheus.Unregister(vec)
+	}
+
+	// the restarted one replaces its collectors and adds the restored values
+	p = newTestPrometheus(t, "test_persistence", newPersistedRouter(), opts...)
+	serve(p.Handler, fasthttp.MethodGet, "/files")
+	if v, _ := metricValue(t, "test_persistence_request_duration_seconds", get); v != 2 {
+		t.Errorf("GET requests after restart = %v, want 2", v)
+	}
+	if v, _ := metricValue(t, "test_persistence_request_duration_post_seconds", post); v != 1 {
+		t.Errorf("POST requests after restart = %v, want 1", v)
+	}
+}
+
+func TestRetiredPersistedHistogram(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	p := newTestPrometheus(t, "test_retired_persisted", newPersistedRouter(),
+		WithPersistence(PersistenceConfig{Path: path, Interval: time.Hour}),
+		WithMethodBuckets(fasthttp.MethodPost, []float64{1.75, 15}),
+		WithLabelMigration(MigrationConfig{Period: 100 * time.Millisecond}),
+	)
+
+	serve(p.Handler, fasthttp.MethodGet, "/files")
+	serve(p.Handler, fasthttp.MethodPost, "/files")
+	time.Sleep(150 * time.Millisecond)
+	serve(p.Handler, fasthttp.MethodGet, "/files")
+	serve(p.Handler, fasthttp.MethodPost, "/files")
+	for _, name := range []string{"test_retired_persisted_request_duration_seconds", "test_retired_persisted_request_duration_post_seconds"} {
+		if len(gatheredLabels(t, name)) != 0 {
+			t.Errorf("%s still exported after the migration period", name)
+		}
+	}
+	if v, _ := metricValue(t, "test_retired_persisted_request_duration_v2_seconds", map[string]string{"method": "POST"}); v != 2 {
+		t.Errorf("POST requests in the split histogram = %v, want 2", v)
+	}
+
+	if err := p.persist(); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := readSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name := range snapshot.Metrics {
+		if name == "test_retired_persisted_request_duration_seconds" || name == "test_retired_persisted_request_duration_post_seconds" {
+			t.Errorf("retired %s still persisted", name)
+		}
+	}
+}
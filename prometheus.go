@@ -1,45 +1,280 @@
 package fasthttpprom
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"runtime/debug"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fasthttp/router"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
 	"github.com/valyala/fasthttp"
 	"github.com/valyala/fasthttp/fasthttpadaptor"
 )
 
 var defaultMetricPath = "/metrics"
 
+// notFoundPath is the path label of requests answered by a custom NotFound handler
+const notFoundPath = "not_found"
+
+// redirectPath is the path label of router generated redirects to unresolvable targets
+const redirectPath = "redirect"
+
+// methodNotAllowedPrefix marks the path label of 405 responses, followed by the pattern
+// of the route registered for other methods
+const methodNotAllowedPrefix = "method_not_allowed_"
+
+// ErrAlreadyInstalled is returned by Use and Custom when the instance already
+// instruments another router, or the same router through the other method
+var ErrAlreadyInstalled = errors.New("fasthttpprom: middleware already added with a different router or method")
+
+// errConfigured is returned when changing the configuration read while serving requests
+// after the middleware is added
+var errConfigured = errors.New("fasthttpprom: configuration cannot change once the middleware is added")
+
+// DefaultBuckets are the default request_duration_seconds histogram buckets, in seconds
+var DefaultBuckets = []float64{.005, .01, .02, 0.04, .06, 0.08, .1, 0.15, .25, 0.4, .6, .8, 1, 1.5, 2, 3, 5}
+
 // ListenerHandler url label
 type ListenerHandler func(c *fasthttp.RequestCtx) string
 
 // Prometheus contains the metrics gathered by the instance and its path
 type Prometheus struct {
-	reqDur        *prometheus.HistogramVec
-	router        *router.Router
-	listenAddress string
-	MetricsPath   string
-	Handler       fasthttp.RequestHandler
+	reqDur                *prometheus.HistogramVec
+	methodReqDur          map[string]*prometheus.HistogramVec
+	buckets               []float64
+	methodBuckets         map[string][]float64
+	seriesEvictions       prometheus.Counter
+	labelOverflows        prometheus.Counter
+	routeCacheHits        prometheus.Counter
+	routeCacheMisses      prometheus.Counter
+	websocketUpgrades     *prometheus.CounterVec
+	activeWebSockets      prometheus.Gauge
+	streamDur             *prometheus.HistogramVec
+	streamBytes           *prometheus.CounterVec
+	rateLimitRejections   *prometheus.CounterVec
+	rateLimitTokens       *prometheus.GaugeVec
+	rateLimitDur          *prometheus.HistogramVec
+	tsrRedirects          *prometheus.CounterVec
+	redirectDur           *prometheus.HistogramVec
+	clientDisconnects     *prometheus.CounterVec
+	handlerErrors         *prometheus.CounterVec
+	skippedRequests       *prometheus.CounterVec
+	instrumentationErrors *prometheus.CounterVec
+	anomalousDurations    *prometheus.CounterVec
+	maintenanceMode       prometheus.Gauge
+	draining              prometheus.Gauge
+	automatedRequests     *prometheus.CounterVec
+	router                *router.Router
+	installed             *router.Router
+	installedCustom       bool
+	installMu             sync.Mutex
+	metricsPath           string
+	endpoints             []string
+	subsystem             string
+	listenAddress         string
+	metricsListener       net.Listener
+	metricsServer         *fasthttp.Server
+	listenerMetrics       bool
+	recoverPanics         bool
+	markUnsetStatus       bool
+	readyz                bool
+	readyzPath            string
+	classifyBots          bool
+	websocketMetrics      bool
+	disconnectMetrics     bool
+	handlerErrorMetrics   bool
+	maintenanceMetric     bool
+	excludeBots           bool
+	skipCodes             map[int]bool
+	statusMapper          func(code int) string
+	strict                bool
+	clock                 clock
+	maxSeries             int
+	seriesTTL             time.Duration
+	maxDuration           time.Duration
+	warmup                time.Duration
+	warmupUntil           time.Time
+	series                *seriesTracker
+	maxPaths              int
+	normalizer            *PathNormalizer
+	fallback              FallbackMode
+	metricsMatcher        func(ctx *fasthttp.RequestCtx) bool
+	maxLabelLength        int
+	routeCacheSize        int
+	routes                *routeCache
+	routeTable            atomic.Pointer[map[string][]string]
+	routesMu              sync.RWMutex
+	patternRegexps        sync.Map
+	ready                 atomic.Bool
+	maintenance           atomic.Bool
+	deployment            atomic.Pointer[string]
+	inFlight              atomic.Int64
+	paths                 *pathGuard
+	push                  *PushConfig
+	pusher                *push.Pusher
+	remoteWrite           *RemoteWriteConfig
+	remoteWriteClient     *fasthttp.Client
+	textfile              *TextfileConfig
+	registrar             Registrar
+	health                *healthChecks
+	healthzPath           string
+	backends              []MetricsBackend
+	skipPrometheus        bool
+	statuszWindow         time.Duration
+	window                *windowStats
+	routeStats            *windowStats
+	slowest               *topSlowest
+	slowestPath           string
+	apiKeys               *topAPIKeys
+	shutdownReport        *shutdownReport
+	persistence           *persistence
+	exemplars             []ExemplarExtractor
+	exemplarSampler       ExemplarSampler
+	labelSources          []labelSource
+	slowHooks             []slowHook
+	relabels              []RelabelFunc
+	accessLogs            []func(ctx *fasthttp.RequestCtx, o Observation)
+	hijackMode            HijackMode
+	redirectMode          RedirectMode
+	warmupMode            WarmupMode
+	lifecycle             LifecycleConfig
+	migration             *migration
+	tenants               *tenants
+	dryRun                *dryRunBackend
+	done                  chan struct{}
+	closeOnce             sync.Once
+	wg                    sync.WaitGroup
+	MetricsPath           string
+	Handler               fasthttp.RequestHandler
 }
 
-// NewPrometheus generates a new set of metrics with a certain subsystem name
-func NewPrometheus(subsystem string) *Prometheus {
+// NewPrometheus generates a new set of metrics with a certain subsystem name. Characters
+// which are not valid in metric names are replaced with underscores.
+func NewPrometheus(subsystem string, opts ...Option) *Prometheus {
+	subsystem = sanitizeSubsystem(subsystem)
 	p := &Prometheus{
+		subsystem:   subsystem,
+		clock:       systemClock{},
+		done:        make(chan struct{}),
 		MetricsPath: defaultMetricPath,
+		slowestPath: defaultSlowestPath,
+		healthzPath: defaultHealthzPath,
+		readyzPath:  defaultReadyzPath,
+		buckets:     DefaultBuckets,
+		maxDuration: defaultMaxDuration,
+	}
+	p.envBuckets()
+	for _, opt := range opts {
+		opt(p)
 	}
+	p.warmupUntil = p.clock.Now().Add(p.warmup)
 	p.registerMetrics(subsystem)
+	if !p.skipPrometheus {
+		p.backends = append([]MetricsBackend{promBackend{p}}, p.backends...)
+	}
+	if p.tenants != nil {
+		p.backends = append([]MetricsBackend{tenantBackend{p}}, p.backends...)
+	}
+	if p.migration != nil {
+		p.registerMigration(subsystem)
+		p.backends = append(p.backends, migrationBackend{p})
+	}
+	if p.statuszWindow > 0 {
+		p.window = newWindowStats(p.statuszWindow)
+		p.backends = append(p.backends, p.window)
+	}
+	if p.routeStats != nil {
+		p.backends = append(p.backends, p.routeStats)
+	}
+	if p.slowest != nil {
+		p.registerTopSlowest(subsystem)
+		p.backends = append(p.backends, p.slowest.stats)
+	}
+	if p.shutdownReport != nil {
+		p.backends = append(p.backends, p.shutdownReport)
+	}
+	if p.dryRun != nil {
+		p.registerDryRun(subsystem)
+		p.backends = []MetricsBackend{p.dryRun}
+	}
+	p.reportDrops()
+	if p.seriesTTL > 0 {
+		p.startSeriesExpiry()
+	}
+	if p.push != nil {
+		p.startPush()
+	}
+	if p.remoteWrite != nil {
+		p.startRemoteWrite()
+	}
+	if p.textfile != nil {
+		p.startTextfile()
+	}
+	if p.health != nil {
+		p.registerHealthChecks(subsystem)
+	}
+	if p.shutdownReport != nil {
+		p.startShutdownReport()
+	}
+	if p.persistence != nil {
+		p.startPersistence(subsystem)
+	}
+	p.registerConfigInfo(subsystem)
 
 	return p
 }
 
+// sanitizeSubsystem replaces the characters which are not valid in metric names, since
+// metrics with invalid names would silently fail to register, and logs the change
+func sanitizeSubsystem(subsystem string) string {
+	valid := []rune(subsystem)
+	for i, r := range valid {
+		if r != '_' && r != ':' && !('a' <= r && r <= 'z') && !('A' <= r && r <= 'Z') && !('0' <= r && r <= '9') {
+			valid[i] = '_'
+		}
+	}
+	name := string(valid)
+	if name != "" && '0' <= name[0] && name[0] <= '9' {
+		name = "_" + name
+	}
+	if name != subsystem {
+		log.Printf("Invalid subsystem %q, using %q\n", subsystem, name)
+	}
+
+	return name
+}
+
+// Close stops the background goroutines started by the configured options and waits
+// for them to finish
+func (p *Prometheus) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.done)
+		p.clock.Stop()
+	})
+	p.wg.Wait()
+	return nil
+}
+
 // SetListenAddress for exposing metrics on address. If not set, it will be exposed at the
-// same address of api that is being used
+// same address of api that is being used. The address cannot change once the middleware
+// is added with Use or Custom.
 func (p *Prometheus) SetListenAddress(address string) {
+	p.installMu.Lock()
+	defer p.installMu.Unlock()
+	if p.installed != nil {
+		log.Printf("Fail to set listen address: %s\n", errConfigured)
+		return
+	}
 	p.listenAddress = address
 	if p.listenAddress != "" {
 		p.router = router.New()
@@ -48,26 +283,94 @@ func (p *Prometheus) SetListenAddress(address string) {
 
 // SetListenAddressWithRouter for using a separate router to expose metrics. (this keeps things like GET /metrics out of
 // your content's access log).
-func (p *Prometheus) SetListenAddressWithRouter(listenAddress string, r *router.Router) {
+// It returns an error, leaving the instance unchanged, for a nil router, an address
+// which is not of the form host:port, or once the middleware is added with Use or Custom.
+func (p *Prometheus) SetListenAddressWithRouter(listenAddress string, r *router.Router) error {
+	p.installMu.Lock()
+	defer p.installMu.Unlock()
+	if p.installed != nil {
+		return errConfigured
+	}
+	if listenAddress != "" {
+		if r == nil {
+			return errors.New("fasthttpprom: nil router for the metrics listener")
+		}
+		if _, _, err := net.SplitHostPort(listenAddress); err != nil {
+			return fmt.Errorf("fasthttpprom: invalid listen address: %w", err)
+		}
+	}
 	p.listenAddress = listenAddress
 	if len(p.listenAddress) > 0 {
 		p.router = r
 	}
+	return nil
 }
 
 // SetMetricsPath set metrics paths for Custom path
 func (p *Prometheus) SetMetricsPath(r *router.Router) {
 	if p.listenAddress != "" {
-		r.GET(p.MetricsPath, prometheusHandler())
+		p.registerEndpoints(r)
 		p.runServer()
 	} else {
-		r.GET(p.MetricsPath, prometheusHandler())
+		p.registerEndpoints(r)
+		p.markReady()
 	}
 }
 
+// registerEndpoints serves the metrics, and the status page if enabled, on r
+func (p *Prometheus) registerEndpoints(r *router.Router) {
+	r.GET(p.MetricsPath, prometheusHandler(len(p.exemplars) > 0))
+	if p.window != nil {
+		p.registerEndpoint(r, defaultStatuszPath, p.statuszHandler())
+	}
+	if p.tenants != nil {
+		r.GET(p.MetricsPath+"/{tenant}", p.tenantHandler())
+	}
+	if p.slowest != nil {
+		p.registerEndpoint(r, p.slowestPath, p.SlowestHandler())
+	}
+	if p.health != nil {
+		p.registerEndpoint(r, p.healthzPath, p.HealthzHandler())
+	}
+	if p.readyz {
+		p.registerEndpoint(r, p.readyzPath, p.ReadyHandler())
+	}
+}
+
+// registerEndpoint serves h on path of r unless path is empty or r already has a GET
+// route there, which belongs to the application and is left alone
+func (p *Prometheus) registerEndpoint(r *router.Router, path string, h fasthttp.RequestHandler) {
+	if path == "" {
+		return
+	}
+	for _, registered := range r.List()[fasthttp.MethodGet] {
+		if registered == path {
+			log.Printf("Fail to serve %s: route already registered\n", path)
+			return
+		}
+	}
+	r.GET(path, h)
+	p.endpoints = append(p.endpoints, path)
+}
+
 func (p *Prometheus) runServer() {
-	if p.listenAddress != "" {
-		go fasthttp.ListenAndServe(p.listenAddress, p.router.Handler)
+	if p.listenAddress == "" {
+		return
+	}
+	ln, err := net.Listen("tcp4", p.listenAddress)
+	if err != nil {
+		log.Printf("Fail to listen on %s: %s\n", p.listenAddress, err)
+		return
+	}
+	if p.listenerMetrics {
+		ln = NewListener(ln, p.subsystem, "metrics")
+	}
+	p.metricsListener = ln
+	p.metricsServer = &fasthttp.Server{Handler: p.router.Handler}
+	go p.metricsServer.Serve(ln)
+	p.markReady()
+	if p.registrar != nil {
+		p.registerDiscovery()
 	}
 }
 
@@ -77,72 +380,574 @@ func (p *Prometheus) registerMetrics(subsystem string) {
 			Subsystem: subsystem,
 			Name:      "request_duration_seconds",
 			Help:      "request latencies",
-			Buckets:   []float64{.005, .01, .02, 0.04, .06, 0.08, .1, 0.15, .25, 0.4, .6, .8, 1, 1.5, 2, 3, 5},
+			Buckets:   p.buckets,
 		},
-		[]string{"code", "path"},
+		p.labelNames(),
 	)
 
 	prometheus.Register(p.reqDur)
+	if len(p.methodBuckets) > 0 {
+		p.registerMethodHistograms(subsystem)
+	}
+
+	if p.websocketMetrics {
+		p.registerWebSocketMetrics(subsystem)
+	}
+
+	p.streamDur = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: subsystem,
+			Name:      "stream_duration_seconds",
+			Help:      "durations of streamed response bodies",
+			Buckets:   prometheus.ExponentialBuckets(.1, 4, 10),
+		},
+		[]string{"path"},
+	)
+	p.streamBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: subsystem,
+			Name:      "stream_bytes_total",
+			Help:      "bytes of streamed response bodies",
+		},
+		[]string{"path"},
+	)
+	prometheus.Register(p.streamDur)
+	prometheus.Register(p.streamBytes)
+
+	p.registerRateLimitMetrics(subsystem)
+	p.registerInstrumentationErrors(subsystem)
+	p.registerRedirectMetrics(subsystem)
+	if p.disconnectMetrics {
+		p.registerDisconnectMetrics(subsystem)
+	}
+	if p.handlerErrorMetrics {
+		p.registerHandlerErrorMetrics(subsystem)
+	}
+	p.registerDurationGuard(subsystem)
+	if p.maintenanceMetric {
+		p.registerMaintenance(subsystem)
+	}
+	p.registerInFlight(subsystem)
+	if p.classifyBots {
+		p.registerBotClassifier(subsystem)
+	}
+	if p.apiKeys != nil {
+		p.registerTopAPIKeys(subsystem)
+	}
+
+	if len(p.skipCodes) > 0 {
+		p.skippedRequests = prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Subsystem: subsystem,
+				Name:      "skipped_requests_total",
+				Help:      "requests not recorded because of their status code",
+			},
+			[]string{"code"},
+		)
+		prometheus.Register(p.skippedRequests)
+	}
+
+	p.tsrRedirects = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: subsystem,
+			Name:      "trailing_slash_redirects_total",
+			Help:      "requests redirected to the canonical route by adding or removing the trailing slash",
+		},
+		[]string{"path"},
+	)
+	prometheus.Register(p.tsrRedirects)
+
+	if p.maxSeries > 0 || p.seriesTTL > 0 {
+		p.series = newSeriesTracker(p.maxSeries)
+	}
+	if p.maxSeries > 0 {
+		p.seriesEvictions = prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Subsystem: subsystem,
+				Name:      "series_evictions_total",
+				Help:      "label combinations evicted to stay within the series budget",
+			},
+		)
+		prometheus.Register(p.seriesEvictions)
+	}
+
+	if p.maxPaths > 0 {
+		p.paths = newPathGuard(p.maxPaths)
+		p.labelOverflows = prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Subsystem: subsystem,
+				Name:      "label_overflow_total",
+				Help:      "requests recorded under the overflow path because of the path cardinality cap",
+			},
+		)
+		prometheus.Register(p.labelOverflows)
+	}
+
+	if p.routeCacheSize > 0 {
+		p.routes = newRouteCache(p.routeCacheSize)
+		lookups := prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Subsystem: subsystem,
+				Name:      "route_cache_lookups_total",
+				Help:      "route pattern cache lookups by result",
+			},
+			[]string{"result"},
+		)
+		p.routeCacheHits = lookups.WithLabelValues("hit")
+		p.routeCacheMisses = lookups.WithLabelValues("miss")
+		prometheus.Register(lookups)
+	}
 }
 
-// Custom adds the middleware to a fasthttp
-func (p *Prometheus) Custom(r *router.Router) {
-	p.router = r
+// labelNames returns the labels of request_duration_seconds
+func (p *Prometheus) labelNames() []string {
+	names := []string{"code", "path"}
+	for _, source := range p.labelSources {
+		names = append(names, source.name)
+	}
+
+	return names
+}
+
+// guardPath returns ep, or the overflow path once the path cardinality cap is reached.
+// In dry-run the cap is not applied, so the paths seen don't take its slots.
+func (p *Prometheus) guardPath(ep string) string {
+	if p.paths == nil || !p.recording() || p.paths.admit(ep) {
+		return ep
+	}
+	p.labelOverflows.Inc()
+
+	return overflowPath
+}
+
+// trackSeries records that labels were observed and deletes the least recently observed
+// series once the series budget is exceeded
+func (p *Prometheus) trackSeries(now time.Time, labels ...string) {
+	if p.series == nil {
+		return
+	}
+	for _, evicted := range p.series.observe(labels, now) {
+		p.deleteSeries(evicted...)
+		p.seriesEvictions.Inc()
+	}
+}
+
+// startSeriesExpiry periodically deletes the series which have not been observed within
+// the series TTL until Close is called
+func (p *Prometheus) startSeriesExpiry() {
+	interval := p.seriesTTL / 2
+	if interval <= 0 {
+		interval = p.seriesTTL
+	}
+	p.runEvery(interval, 0, func() {
+		for _, expired := range p.series.expire(p.clock.Now().Add(-p.seriesTTL)) {
+			p.deleteSeries(expired...)
+		}
+	}, nil)
+}
+
+// Custom adds the middleware to a fasthttp, serving the metrics on MetricsPath, which
+// cannot change afterwards. Calling it again with the same router is a
+// no-op, calling it with another router or after Use returns ErrAlreadyInstalled.
+func (p *Prometheus) Custom(r *router.Router) error {
+	if installed, err := p.install(r, true); installed || err != nil {
+		return err
+	}
+	p.setRouter(r)
 	p.SetMetricsPath(r)
 	p.Handler = p.HandlerFunc()
+	return nil
 }
 
-// Use adds the middleware to a fasthttp
-func (p *Prometheus) Use(r *router.Router) {
-	p.router = r
-	r.GET(p.MetricsPath, prometheusHandler())
+// Use adds the middleware to a fasthttp, serving the metrics on MetricsPath, which
+// cannot change afterwards. Calling it again with the same router is a
+// no-op, calling it with another router or after Custom returns ErrAlreadyInstalled.
+func (p *Prometheus) Use(r *router.Router) error {
+	if installed, err := p.install(r, false); installed || err != nil {
+		return err
+	}
+	p.setRouter(r)
+	p.registerEndpoints(r)
 	p.Handler = p.HandlerFunc()
+	p.markReady()
+	return nil
+}
+
+// install records that the middleware is added to r, reporting whether it already was.
+// An instance instruments a single router, so adding it to another one is an error.
+func (p *Prometheus) install(r *router.Router, custom bool) (bool, error) {
+	p.installMu.Lock()
+	defer p.installMu.Unlock()
+	if p.installed == nil {
+		p.installed = r
+		p.installedCustom = custom
+		p.metricsPath = p.MetricsPath
+		return false, nil
+	}
+	if p.installed != r || p.installedCustom != custom {
+		return false, ErrAlreadyInstalled
+	}
+
+	return true, nil
 }
 
 // HandlerFunc is onion or wraper to handler for fasthttp listenandserve
 func (p *Prometheus) HandlerFunc() fasthttp.RequestHandler {
 	return func(ctx *fasthttp.RequestCtx) {
 		uri := string(ctx.Request.URI().Path())
-		if uri == p.MetricsPath {
+		if p.isMetricsRequest(ctx, uri) {
 			// next
-			p.router.Handler(ctx)
+			p.dispatch(ctx)
 			return
 		}
-		start := time.Now()
-		// next
-		p.router.Handler(ctx)
-
-		status := strconv.Itoa(ctx.Response.StatusCode())
-		elapsed := float64(time.Since(start)) / float64(time.Second)
-		// get route pattern of url
-		routeList := p.router.List()
-		paths, ok := routeList[string(ctx.Request.Header.Method())]
-		handler, _ := p.router.Lookup(string(ctx.Request.Header.Method()), uri, ctx)
-		if ok {
-			for _, v := range paths {
-				tmp, _ := p.router.Lookup(string(ctx.Request.Header.Method()), v, ctx)
-				if fmt.Sprintf("%v", tmp) == fmt.Sprintf("%v", handler) {
-					uri = v
-					break
+		start := p.clock.Now()
+		p.inFlight.Add(1)
+		defer p.inFlight.Add(-1)
+		defer func() {
+			// record panicking requests as 500s before handing the panic on
+			if rcv := recover(); rcv != nil {
+				p.observe(ctx, uri, start, fasthttp.StatusInternalServerError)
+				if !p.recoverPanics || p.router.PanicHandler != nil {
+					panic(rcv)
 				}
+				log.Printf("Recovered panic serving %s: %v\n%s", uri, rcv, debug.Stack())
+				ctx.Error(fasthttp.StatusMessage(fasthttp.StatusInternalServerError), fasthttp.StatusInternalServerError)
 			}
+		}()
+		if p.markUnsetStatus {
+			ctx.Response.SetStatusCode(unsetStatusCode)
 		}
-		ep := ""
-		if status == "404" {
-			ep = "404_" + string(ctx.Method())
-		} else {
-			ep = string(ctx.Method()) + "_" + uri
+		// next
+		p.dispatch(ctx)
+		code := ctx.Response.StatusCode()
+		if code == unsetStatusCode {
+			// the handler never set a status, answer with fasthttp's default
+			ctx.Response.SetStatusCode(fasthttp.StatusOK)
 		}
-		ob, err := p.reqDur.GetMetricWithLabelValues(status, ep)
-		if err != nil {
-			log.Printf("Fail to GetMetricWithLabelValues: %s\n", err)
-			return
+		p.observe(ctx, uri, start, code)
+	}
+}
+
+// isMetricsRequest reports whether the request to uri is served by the middleware
+// itself and therefore not instrumented
+func (p *Prometheus) isMetricsRequest(ctx *fasthttp.RequestCtx, uri string) bool {
+	if p.metricsMatcher != nil {
+		return p.metricsMatcher(ctx)
+	}
+
+	return p.isOwnEndpoint(uri)
+}
+
+// isOwnEndpoint reports whether path is one of the endpoints served by the middleware
+func (p *Prometheus) isOwnEndpoint(path string) bool {
+	return isEndpointPath(path, p.metricsPath) || p.isTenantMetricsPath(path) ||
+		p.isEndpoint(path)
+}
+
+// isEndpoint reports whether path is one of the optional endpoints registered on the
+// router, excluding the ones the application registered itself
+func (p *Prometheus) isEndpoint(path string) bool {
+	for _, endpoint := range p.endpoints {
+		if isEndpointPath(path, endpoint) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isEndpointPath reports whether uri is endpoint, with or without a trailing slash, so
+// scrapes of f.e /metrics/ are not instrumented when the router redirects them
+func isEndpointPath(uri, endpoint string) bool {
+	return uri == endpoint || len(uri) > 1 && uri == toggleTrailingSlash(endpoint)
+}
+
+// observe records the request to uri which started at start and was answered with code.
+// Handlers which never set a status code are recorded as 200, fasthttp's default.
+func (p *Prometheus) observe(ctx *fasthttp.RequestCtx, uri string, start time.Time, code int) {
+	status := strconv.Itoa(code)
+	if p.skipCodes[code] {
+		if p.recording() {
+			p.skippedRequests.WithLabelValues(status).Inc()
+		}
+		return
+	}
+	if p.warmupMode == WarmupSkip && p.inWarmup(start) {
+		return
+	}
+	if p.classifyBots && p.countBot(ctx) {
+		return
+	}
+	if p.markUnsetStatus && code == unsetStatusCode {
+		status = unsetStatus
+	}
+	duration := p.guardDuration(p.clock.Now().Sub(start))
+	requestMethod := string(ctx.Method())
+	m := p.routePattern(ctx, requestMethod, uri)
+	if !m.matched && p.router.RedirectFixedPath && isRedirect(code) {
+		m = p.redirectTarget(ctx, requestMethod)
+	}
+	method := p.methodLabel(requestMethod)
+	ep := p.pathLabel(method, m, status)
+	if ep == "" {
+		return
+	}
+	if m.tsr && code/100 == 3 && p.recording() {
+		p.tsrRedirects.WithLabelValues(ep).Inc()
+	}
+	p.countHandlerError(ctx, ep)
+	if p.apiKeys != nil && p.recording() {
+		p.countAPIKey(ctx)
+	}
+	if isWebSocket(ctx) {
+		// the duration of an upgrade is meaningless, the connection lives on
+		p.trackWebSocket(ctx, ep)
+		return
+	}
+	if p.hijackMode == HijackExclude && ctx.Hijacked() {
+		return
+	}
+	p.trackDisconnect(ctx, ep)
+	p.notifySlow(ctx, ep, duration)
+	if p.statusMapper != nil && status != unsetStatus {
+		status = p.statusMapper(code)
+	}
+	o := Observation{Code: status, Method: method, Path: ep, Start: start, Duration: duration}
+	if code/100 == 3 && p.recordRedirect(o) {
+		return
+	}
+	if len(p.exemplars) > 0 && (p.exemplarSampler == nil || p.exemplarSampler(ctx, duration)) {
+		o.Exemplar = p.exemplar(ctx)
+	}
+	if len(p.labelSources) > 0 {
+		o.Labels = p.extraLabels(ctx)
+		p.labelWarmup(&o)
+	}
+	o.Tenant = p.tenantOf(ctx)
+	if len(p.relabels) > 0 && !p.relabel(&o) {
+		return
+	}
+	p.logAccess(ctx, o)
+	p.record(o)
+}
+
+// routeMatch is the resolution of a request path against the registered routes
+type routeMatch struct {
+	// pattern is the registered route pattern, or the request path when no route matched
+	pattern string
+	matched bool
+	// tsr is set when the route only matched with the trailing slash added or removed,
+	// so the router answered with a redirect to it
+	tsr bool
+	// allowed is the pattern of a route registered for other methods only, when the
+	// path did not match a route for the request method
+	allowed string
+	// redirect is set for redirects generated by the router whose target could not be
+	// resolved to a route
+	redirect bool
+}
+
+// requestLabel returns the path label of the request of ctx answered with status
+func (p *Prometheus) requestLabel(ctx *fasthttp.RequestCtx, status string) string {
+	m := p.routePattern(ctx, string(ctx.Method()), string(ctx.Request.URI().Path()))
+	return p.pathLabel(p.methodLabel(string(ctx.Method())), m, status)
+}
+
+// pathLabel returns the path label of a request resolved to m and answered with status,
+// or "" when the request is not to be recorded
+func (p *Prometheus) pathLabel(method string, m routeMatch, status string) string {
+	pattern := m.pattern
+	if !m.matched {
+		pattern = stripQuery(cleanPathLabel(pattern))
+	}
+	ep := ""
+	switch {
+	case m.redirect:
+		ep = redirectPath
+	case m.allowed != "" && status == "405":
+		ep = methodNotAllowedPrefix + m.allowed
+	case !m.matched && p.normalizer != nil && p.fallback == FallbackPath:
+		ep = routeLabel(method, stripQuery(p.normalizer.Normalize(pattern)))
+	case !m.matched && p.router.NotFound != nil:
+		// answered by the custom NotFound handler, whatever its status
+		ep = notFoundPath
+	case status == "404":
+		ep = "404_" + method
+	case !m.matched && p.fallback == FallbackUnknown:
+		ep = unknownPath
+	case !m.matched && p.fallback == FallbackDrop:
+		return ""
+	default:
+		ep = routeLabel(method, pattern)
+	}
+
+	return p.guardPath(truncateLabel(sanitizeLabel(ep), p.maxLabelLength))
+}
+
+// routePattern resolves path to the registered pattern of the route serving it
+func (p *Prometheus) routePattern(ctx *fasthttp.RequestCtx, method, path string) routeMatch {
+	if p.routes == nil {
+		return p.lookupPattern(ctx, method, path)
+	}
+	key := routeCacheKey(method, path)
+	if m, ok := p.routes.get(key); ok {
+		if p.recording() {
+			p.routeCacheHits.Inc()
 		}
-		ob.Observe(elapsed)
+		return m
 	}
+	if p.recording() {
+		p.routeCacheMisses.Inc()
+	}
+	m := p.lookupPattern(ctx, method, path)
+	p.routes.add(key, m)
+
+	return m
+}
+
+// lookupPattern resolves the route pattern by walking the routes registered for method.
+// Paths the router redirects because of a trailing slash resolve to the canonical route.
+// The router never serves HEAD requests with GET handlers, a GET handler serves them
+// only when registered for HEAD too, so they are always labeled HEAD.
+// Routes registered directly on the router after the snapshot was taken are found by
+// refreshing it once they changed.
+func (p *Prometheus) lookupPattern(ctx *fasthttp.RequestCtx, method, path string) routeMatch {
+	routes := p.registeredRoutes()
+	m, found := p.resolvePattern(ctx, routes, method, path)
+	if found && !m.matched && p.routesChanged(routes) {
+		m, _ = p.resolvePattern(ctx, p.refreshRoutes(), method, path)
+	}
+
+	return m
+}
+
+// resolvePattern resolves the pattern of path among routes, reporting whether the router
+// has a handler for it. The routes cannot change meanwhile.
+func (p *Prometheus) resolvePattern(ctx *fasthttp.RequestCtx, routes map[string][]string, method, path string) (routeMatch, bool) {
+	p.routesMu.RLock()
+	defer p.routesMu.RUnlock()
+
+	handler, tsr := p.router.Lookup(method, path, ctx)
+	if handler == nil && tsr {
+		handler, _ = p.router.Lookup(method, toggleTrailingSlash(path), ctx)
+	}
+	if handler == nil {
+		return routeMatch{pattern: path, allowed: p.allowedPattern(ctx, routes, method, path)}, false
+	}
+	// routes registered with ANY serve every method, the label keeps the request method
+	for _, patterns := range [][]string{routes[method], routes[router.MethodWild]} {
+		if pattern, ok := p.patternOf(ctx, patterns, method, path, handler); ok {
+			return routeMatch{pattern: pattern, matched: true, tsr: tsr}, true
+		}
+	}
+
+	return routeMatch{pattern: path}, true
 }
 
-// since prometheus/client_golang use net/http we need this net/http adapter for fasthttp
-func prometheusHandler() fasthttp.RequestHandler {
-	return fasthttpadaptor.NewFastHTTPHandler(promhttp.Handler())
+// patternOf returns the pattern among patterns registered for method with handler, the
+// handler of path. Patterns with regular expression parameters, which don't match
+// themselves, are matched against path instead.
+func (p *Prometheus) patternOf(ctx *fasthttp.RequestCtx, patterns []string, method, path string, handler fasthttp.RequestHandler) (string, bool) {
+	for _, v := range patterns {
+		tmp, _ := p.router.Lookup(method, v, ctx)
+		if fmt.Sprintf("%v", tmp) == fmt.Sprintf("%v", handler) {
+			return v, true
+		}
+	}
+	for _, v := range patterns {
+		if re := p.patternRegexp(v); re != nil && re.MatchString(path) {
+			return v, true
+		}
+	}
+
+	return "", false
+}
+
+// allowedPattern returns the pattern of the route serving path for a method other than
+// method, which the router answers with 405 Method Not Allowed
+func (p *Prometheus) allowedPattern(ctx *fasthttp.RequestCtx, routes map[string][]string, method, path string) string {
+	methods := make([]string, 0, len(routes))
+	for m := range routes {
+		if m != method {
+			methods = append(methods, m)
+		}
+	}
+	sort.Strings(methods)
+	for _, m := range methods {
+		if handler, _ := p.router.Lookup(m, path, ctx); handler != nil {
+			if pattern, ok := p.patternOf(ctx, routes[m], m, path, handler); ok {
+				return pattern
+			}
+		}
+	}
+
+	return ""
+}
+
+// redirectTarget resolves the Location of a redirect generated by the router for a
+// malformed path, f.e /FOO//bar, to the corrected route
+func (p *Prometheus) redirectTarget(ctx *fasthttp.RequestCtx, method string) routeMatch {
+	u := fasthttp.AcquireURI()
+	defer fasthttp.ReleaseURI(u)
+	if err := u.Parse(nil, ctx.Response.Header.Peek(fasthttp.HeaderLocation)); err == nil {
+		if m := p.routePattern(ctx, method, string(u.Path())); m.matched {
+			return m
+		}
+	}
+
+	return routeMatch{redirect: true}
+}
+
+func isRedirect(code int) bool {
+	return code == fasthttp.StatusMovedPermanently || code == fasthttp.StatusTemporaryRedirect ||
+		code == fasthttp.StatusPermanentRedirect
+}
+
+// toggleTrailingSlash adds the trailing slash to path, or removes it if present
+func toggleTrailingSlash(path string) string {
+	if len(path) > 1 && strings.HasSuffix(path, "/") {
+		return path[:len(path)-1]
+	}
+
+	return path + "/"
+}
+
+// DeleteRouteMetrics drops every series recorded for the route registered with method and
+// pattern, for applications that deregister or version out routes. It returns the number
+// of deleted series.
+func (p *Prometheus) DeleteRouteMetrics(method, pattern string) int {
+	ep := routeLabel(method, pattern)
+	if p.series != nil {
+		p.series.forget(func(labels []string) bool { return labels[1] == ep })
+	}
+	if p.paths != nil {
+		p.paths.release(ep)
+	}
+	if p.routes != nil {
+		p.routes.purge()
+	}
+
+	deleted := p.reqDur.DeletePartialMatch(prometheus.Labels{"path": ep})
+	for _, vec := range p.methodReqDur {
+		deleted += vec.DeletePartialMatch(prometheus.Labels{"path": ep})
+	}
+
+	return deleted
+}
+
+// routeLabel builds the path label value of a matched route
+func routeLabel(method, pattern string) string {
+	return method + "_" + pattern
+}
+
+// since prometheus/client_golang use net/http we need this net/http adapter for fasthttp.
+// OpenMetrics is needed to expose exemplars.
+func prometheusHandler(openMetrics bool) fasthttp.RequestHandler {
+	if !openMetrics {
+		return fasthttpadaptor.NewFastHTTPHandler(promhttp.Handler())
+	}
+	return fasthttpadaptor.NewFastHTTPHandler(promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}),
+	))
 }
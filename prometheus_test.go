@@ -0,0 +1,202 @@
+package fasthttpprom
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// newTestPrometheus adds a new instance with subsystem to r. Every test uses its own
+// subsystem since the metrics are registered with the default registry.
+func newTestPrometheus(t *testing.T, subsystem string, r *router.Router, opts ...Option) *Prometheus {
+	t.Helper()
+	p := NewPrometheus(subsystem, opts...)
+	t.Cleanup(func() { p.Close() })
+	if err := p.Use(r); err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+// serve runs a request with method and requestURI through h
+func serve(h fasthttp.RequestHandler, method, requestURI string) *fasthttp.RequestCtx {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.SetMethod(method)
+	ctx.Request.SetRequestURI(requestURI)
+	h(ctx)
+
+	return ctx
+}
+
+// recorder is a MetricsBackend keeping the observations
+type recorder struct {
+	mu           sync.Mutex
+	observations []Observation
+}
+
+func (r *recorder) Record(o Observation) {
+	r.mu.Lock()
+	r.observations = append(r.observations, o)
+	r.mu.Unlock()
+}
+
+// last returns the latest observation
+func (r *recorder) last(t *testing.T) Observation {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.observations) == 0 {
+		t.Fatal("no observation recorded")
+	}
+
+	return r.observations[len(r.observations)-1]
+}
+
+// gatheredLabels returns the labels of every series of the metric family name
+func gatheredLabels(t *testing.T, name string) []map[string]string {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var series []map[string]string
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, pair := range m.GetLabel() {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			series = append(series, labels)
+		}
+	}
+
+	return series
+}
+
+func TestUnmatchedPathLabel(t *testing.T) {
+	p := NewPrometheus("test_unmatched_path")
+	defer p.Close()
+	p.setRouter(router.New())
+
+	for uri, want := range map[string]string{
+		"/a%2541": "GET_/a%41",
+		"/b%2Fc":  "GET_/b/c",
+		"/b%2fc":  "GET_/b/c",
+		"/d%ff":   "GET_/d\uFFFD",
+	} {
+		var u fasthttp.URI
+		u.Parse(nil, []byte(uri))
+		m := routeMatch{pattern: string(u.Path())}
+		if got := p.pathLabel(fasthttp.MethodGet, m, "200"); got != want {
+			t.Errorf("path label of %s = %q, want %q", uri, got, want)
+		}
+	}
+}
+
+// standardMethods are the methods every route is requested with in the method matrix
+var standardMethods = []string{
+	fasthttp.MethodGet, fasthttp.MethodHead, fasthttp.MethodPost, fasthttp.MethodPut,
+	fasthttp.MethodPatch, fasthttp.MethodDelete, fasthttp.MethodConnect,
+	fasthttp.MethodOptions, fasthttp.MethodTrace,
+}
+
+func TestMethodMatrix(t *testing.T) {
+	// routes are resolved by comparing handlers, so every route needs its own
+	r := router.New()
+	r.GET("/get", func(ctx *fasthttp.RequestCtx) { ctx.SetBodyString("get") })
+	r.ANY("/any", func(ctx *fasthttp.RequestCtx) { ctx.SetBodyString("any") })
+	both := func(ctx *fasthttp.RequestCtx) { ctx.SetBodyString("both") }
+	r.GET("/both", both)
+	r.HEAD("/both", both)
+	for _, method := range standardMethods {
+		r.Handle(method, "/each", func(ctx *fasthttp.RequestCtx) { ctx.SetBodyString("each") })
+	}
+	rec := &recorder{}
+	p := newTestPrometheus(t, "test_method_matrix", r, WithBackend(rec))
+
+	for _, method := range standardMethods {
+		// the router never serves HEAD with GET handlers, HEAD requests of GET only
+		// routes are answered 405 like any other method
+		getPath, bothPath := methodNotAllowedPrefix+"/get", methodNotAllowedPrefix+"/both"
+		switch method {
+		case fasthttp.MethodGet, fasthttp.MethodHead:
+			bothPath = method + "_/both"
+			if method == fasthttp.MethodGet {
+				getPath = "GET_/get"
+			}
+		case fasthttp.MethodOptions:
+			// answered by the router with the Allow header
+			getPath, bothPath = "OPTIONS_/get", "OPTIONS_/both"
+		}
+		for uri, want := range map[string]string{
+			"/get":  getPath,
+			"/both": bothPath,
+			"/any":  method + "_/any",
+			"/each": method + "_/each",
+		} {
+			serve(p.Handler, method, uri)
+			o := rec.last(t)
+			if o.Method != method || o.Path != want {
+				t.Errorf("%s %s recorded as method %q path %q, want %q %q", method, uri, o.Method, o.Path, method, want)
+			}
+		}
+	}
+}
+
+func TestReconfigureWhileServing(t *testing.T) {
+	r := router.New()
+	r.GET("/users/{id}", func(ctx *fasthttp.RequestCtx) {})
+	p := NewPrometheus("test_reconfigure")
+	defer p.Close()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				p.SetListenAddress("")
+				p.SetListenAddressWithRouter("", nil)
+			}
+		}()
+	}
+	if err := p.Use(r); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				serve(p.Handler, fasthttp.MethodGet, "/users/1")
+				if err := p.Use(r); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	if err := p.SetListenAddressWithRouter(":9090", router.New()); err != errConfigured {
+		t.Errorf("SetListenAddressWithRouter once installed = %v, want %v", err, errConfigured)
+	}
+	if err := p.Custom(r); err != ErrAlreadyInstalled {
+		t.Errorf("Custom after Use = %v, want %v", err, ErrAlreadyInstalled)
+	}
+}
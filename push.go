@@ -0,0 +1,82 @@
+package fasthttpprom
+
+import (
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// PushConfig configures pushing the metrics to a Prometheus Pushgateway
+type PushConfig struct {
+	// URL of the Pushgateway
+	URL string
+	// Job is the job label of the pushed group
+	Job string
+	// Grouping adds further grouping labels to the pushed group
+	Grouping map[string]string
+	// Interval between pushes. No periodic pushes are made when it is zero.
+	Interval time.Duration
+	// Jitter adds a random delay of up to Jitter to every interval, so a fleet of
+	// instances doesn't push in lockstep
+	Jitter time.Duration
+	// PushOnClose makes a final push when Close is called
+	PushOnClose bool
+	// DeleteOnClose deletes the pushed group from the Pushgateway when Close is called,
+	// after the final push if any
+	DeleteOnClose bool
+	// ErrorHandler is called with every failed push. Errors are logged when it is nil.
+	ErrorHandler func(error)
+}
+
+// WithPush pushes the metrics to a Pushgateway every cfg.Interval until Close is called
+func WithPush(cfg PushConfig) Option {
+	return func(p *Prometheus) {
+		p.push = &cfg
+	}
+}
+
+// Push sends the current metrics to the Pushgateway configured with WithPush
+func (p *Prometheus) Push() error {
+	if p.pusher == nil {
+		return nil
+	}
+
+	return p.pusher.Push()
+}
+
+func (p *Prometheus) newPusher() *push.Pusher {
+	pusher := push.New(p.push.URL, p.push.Job).Gatherer(prometheus.DefaultGatherer)
+	for name, value := range p.push.Grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+
+	return pusher
+}
+
+// startPush schedules the periodic pushes and the configured final push and delete
+func (p *Prometheus) startPush() {
+	p.pusher = p.newPusher()
+	p.runEvery(p.push.Interval, p.push.Jitter, func() {
+		p.pushError(p.pusher.Push())
+	}, func() {
+		if p.push.PushOnClose {
+			p.pushError(p.pusher.Push())
+		}
+		if p.push.DeleteOnClose {
+			p.pushError(p.pusher.Delete())
+		}
+	})
+}
+
+func (p *Prometheus) pushError(err error) {
+	if err == nil {
+		return
+	}
+	if p.push.ErrorHandler != nil {
+		p.push.ErrorHandler(err)
+		return
+	}
+	log.Printf("Fail to push metrics: %s\n", err)
+}
@@ -0,0 +1,46 @@
+package fasthttpprom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// Limiter hands out execution slots to requests, f.e to cap the number of requests
+// handled concurrently
+type Limiter interface {
+	// Acquire waits for a slot for the request of ctx, returning the func releasing it,
+	// or false when the request is to be rejected
+	Acquire(ctx *fasthttp.RequestCtx) (release func(), ok bool)
+}
+
+// LimitHandler runs next once l hands out a slot for the request, answering 503 Service
+// Unavailable when l rejects it. The time waited for the slot is recorded in
+// request_queue_duration_seconds by result, "acquired" or "rejected", so queueing can be
+// told apart from processing latency.
+//
+//	s := &fasthttp.Server{Handler: p.LimitHandler(l, p.Handler)}
+func (p *Prometheus) LimitHandler(l Limiter, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	queueDur := registerCollector(prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: p.subsystem,
+			Name:      "request_queue_duration_seconds",
+			Help:      "time requests waited for an execution slot by result",
+			Buckets:   p.buckets,
+		},
+		[]string{"result"},
+	)).(*prometheus.HistogramVec)
+
+	return func(ctx *fasthttp.RequestCtx) {
+		start := p.clock.Now()
+		release, ok := l.Acquire(ctx)
+		waited := p.clock.Now().Sub(start).Seconds()
+		if !ok {
+			queueDur.WithLabelValues("rejected").Observe(waited)
+			ctx.Error(fasthttp.StatusMessage(fasthttp.StatusServiceUnavailable), fasthttp.StatusServiceUnavailable)
+			return
+		}
+		queueDur.WithLabelValues("acquired").Observe(waited)
+		defer release()
+		next(ctx)
+	}
+}
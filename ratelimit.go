@@ -0,0 +1,79 @@
+package fasthttpprom
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// RateLimitDecision is the outcome of a rate limiter for a request
+type RateLimitDecision struct {
+	// Limiter names the limiter which made the decision
+	Limiter string
+	// Rejected is true when the request was throttled
+	Rejected bool
+	// Latency is the time the limiter took to decide
+	Latency time.Duration
+}
+
+// RateLimitObserver receives the decisions and token levels of rate limiting
+// middlewares. Prometheus implements it, so throttling is recorded next to the request
+// metrics with the same path labels.
+type RateLimitObserver interface {
+	ObserveRateLimit(ctx *fasthttp.RequestCtx, d RateLimitDecision)
+	SetRateLimitTokens(limiter string, tokens float64)
+}
+
+// ObserveRateLimit records the decision of a rate limiter for the request of ctx in
+// ratelimit_decision_duration_seconds and, when rejected, ratelimit_rejected_total by
+// limiter and path
+func (p *Prometheus) ObserveRateLimit(ctx *fasthttp.RequestCtx, d RateLimitDecision) {
+	p.rateLimitDur.WithLabelValues(d.Limiter).Observe(d.Latency.Seconds())
+	if !d.Rejected {
+		return
+	}
+	ep := p.requestLabel(ctx, strconv.Itoa(ctx.Response.StatusCode()))
+	if ep == "" {
+		return
+	}
+	p.rateLimitRejections.WithLabelValues(d.Limiter, ep).Inc()
+}
+
+// SetRateLimitTokens records the tokens currently available to limiter in
+// ratelimit_tokens
+func (p *Prometheus) SetRateLimitTokens(limiter string, tokens float64) {
+	p.rateLimitTokens.WithLabelValues(limiter).Set(tokens)
+}
+
+func (p *Prometheus) registerRateLimitMetrics(subsystem string) {
+	p.rateLimitRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: subsystem,
+			Name:      "ratelimit_rejected_total",
+			Help:      "requests rejected by rate limiters",
+		},
+		[]string{"limiter", "path"},
+	)
+	p.rateLimitTokens = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: subsystem,
+			Name:      "ratelimit_tokens",
+			Help:      "tokens currently available to rate limiters",
+		},
+		[]string{"limiter"},
+	)
+	p.rateLimitDur = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: subsystem,
+			Name:      "ratelimit_decision_duration_seconds",
+			Help:      "rate limiter decision latencies",
+			Buckets:   prometheus.ExponentialBuckets(.0001, 4, 8),
+		},
+		[]string{"limiter"},
+	)
+	prometheus.Register(p.rateLimitRejections)
+	prometheus.Register(p.rateLimitTokens)
+	prometheus.Register(p.rateLimitDur)
+}
@@ -0,0 +1,53 @@
+package fasthttpprom
+
+import (
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+var defaultReadyzPath = "/readyz"
+
+// WithReadyz serves ReadyHandler on /readyz of the instrumented router
+func WithReadyz() Option {
+	return func(p *Prometheus) {
+		p.readyz = true
+	}
+}
+
+// WithReadyzPath serves ReadyHandler of WithReadyz on path instead of /readyz. An empty
+// path serves it nowhere, f.e to mount ReadyHandler on a route of the application.
+func WithReadyzPath(path string) Option {
+	return func(p *Prometheus) {
+		p.readyzPath = path
+	}
+}
+
+// Ready reports whether the metrics are served: the metrics listener started by
+// SetListenAddress is bound, or the metrics endpoint is registered on the instrumented
+// router, and the registry can be gathered. Deployments gating their readiness on it
+// don't go live unobservable.
+func (p *Prometheus) Ready() bool {
+	return p.ready.Load()
+}
+
+// ReadyHandler answers 200 OK once Ready, 503 Service Unavailable before
+func (p *Prometheus) ReadyHandler() fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if !p.Ready() {
+			ctx.Error("metrics not served yet", fasthttp.StatusServiceUnavailable)
+			return
+		}
+		ctx.SetBodyString("ready")
+	}
+}
+
+// markReady marks the metrics as served once the registry can be gathered
+func (p *Prometheus) markReady() {
+	if _, err := prometheus.DefaultGatherer.Gather(); err != nil {
+		log.Printf("Fail to gather metrics: %s\n", err)
+		return
+	}
+	p.ready.Store(true)
+}
@@ -0,0 +1,49 @@
+package fasthttpprom
+
+import (
+	"testing"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+func TestReadyzPath(t *testing.T) {
+	for name, tc := range map[string]struct {
+		opts []Option
+		// path ReadyHandler is served on, if any
+		path string
+	}{
+		"default": {path: defaultReadyzPath},
+		"custom":  {opts: []Option{WithReadyzPath("/-/ready")}, path: "/-/ready"},
+		"none":    {opts: []Option{WithReadyzPath("")}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := router.New()
+			p := newTestPrometheus(t, "test_readyz_path_"+name, r, append([]Option{WithReadyz()}, tc.opts...)...)
+
+			if tc.path != "" {
+				if ctx := serve(p.Handler, fasthttp.MethodGet, tc.path); ctx.Response.StatusCode() != fasthttp.StatusOK {
+					t.Errorf("GET %s = %d, want 200", tc.path, ctx.Response.StatusCode())
+				}
+			}
+			if ctx := serve(p.Handler, fasthttp.MethodGet, defaultReadyzPath); tc.path != defaultReadyzPath && ctx.Response.StatusCode() != fasthttp.StatusNotFound {
+				t.Errorf("GET %s = %d, want 404", defaultReadyzPath, ctx.Response.StatusCode())
+			}
+		})
+	}
+}
+
+func TestReadyzApplicationRoute(t *testing.T) {
+	r := router.New()
+	r.GET(defaultReadyzPath, func(ctx *fasthttp.RequestCtx) { ctx.SetBodyString("app") })
+	rec := &recorder{}
+	p := newTestPrometheus(t, "test_readyz_application_route", r, WithReadyz(), WithBackend(rec))
+
+	ctx := serve(p.Handler, fasthttp.MethodGet, defaultReadyzPath)
+	if body := string(ctx.Response.Body()); body != "app" {
+		t.Errorf("GET %s answered %q, want the application route", defaultReadyzPath, body)
+	}
+	if o := rec.last(t); o.Path != "GET_"+defaultReadyzPath {
+		t.Errorf("application route recorded as %q", o.Path)
+	}
+}
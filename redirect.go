@@ -0,0 +1,59 @@
+package fasthttpprom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RedirectMode selects how requests answered with a 3xx code are recorded
+type RedirectMode int
+
+const (
+	// RedirectRecord records redirects in request_duration_seconds like any other
+	// response. It is the default.
+	RedirectRecord RedirectMode = iota
+	// RedirectSeparate records redirects in redirect_duration_seconds instead, so large
+	// redirect volumes, f.e from auth flows, don't distort the latency of the routes
+	RedirectSeparate
+	// RedirectSkip does not record redirects
+	RedirectSkip
+)
+
+// WithRedirectMode sets how requests answered with a 3xx code are recorded. Trailing
+// slash redirects are counted in trailing_slash_redirects_total whatever the mode.
+func WithRedirectMode(mode RedirectMode) Option {
+	return func(p *Prometheus) {
+		p.redirectMode = mode
+	}
+}
+
+func (p *Prometheus) registerRedirectMetrics(subsystem string) {
+	if p.redirectMode != RedirectSeparate {
+		return
+	}
+	p.redirectDur = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: subsystem,
+			Name:      "redirect_duration_seconds",
+			Help:      "latencies of requests answered with a redirect",
+			Buckets:   p.buckets,
+		},
+		[]string{"code", "path"},
+	)
+	prometheus.Register(p.redirectDur)
+}
+
+// recordRedirect records o according to the redirect mode, reporting whether it did so
+// instead of the regular recording
+func (p *Prometheus) recordRedirect(o Observation) bool {
+	switch p.redirectMode {
+	case RedirectSeparate:
+		if p.recording() {
+			p.redirectDur.WithLabelValues(o.Code, o.Path).Observe(o.Duration.Seconds())
+		}
+		return true
+	case RedirectSkip:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,34 @@
+package fasthttpprom
+
+import (
+	"net"
+
+	"github.com/valyala/fasthttp"
+)
+
+// RegionResolver resolves the coarse region or country of a client IP, f.e from a
+// MaxMind database or an internal IPAM
+type RegionResolver interface {
+	Region(ip net.IP) string
+}
+
+// WithRegionLabel adds a label called name, f.e "region" or "country", to
+// request_duration_seconds with the value resolved by r from ctx.RemoteIP(). Values
+// outside allowed are recorded as "other" and unresolved IPs as "unknown", keeping the
+// label bounded.
+func WithRegionLabel(name string, r RegionResolver, allowed ...string) Option {
+	set := make(map[string]bool, len(allowed))
+	for _, v := range allowed {
+		set[v] = true
+	}
+
+	return func(p *Prometheus) {
+		p.labelSources = append(p.labelSources, labelSource{
+			name: name,
+			extract: func(ctx *fasthttp.RequestCtx) string {
+				return boundedLabel(r.Region(ctx.RemoteIP()), set)
+			},
+			values: len(set) + 2,
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package fasthttpprom
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// RelabelFunc rewrites the labels of an observation, keyed by label name with "code",
+// "method" and "path" next to the additional labels. Returning nil drops the observation.
+type RelabelFunc func(labels map[string]string) map[string]string
+
+// WithRelabel runs fn on the labels of every observation before it is recorded, so
+// operators can rewrite or drop labels, f.e mask tenant IDs or collapse API versions,
+// without changing the application. Labels which are not recorded are ignored and
+// missing ones are recorded empty. Several relabel funcs run in the order given.
+func WithRelabel(fn RelabelFunc) Option {
+	return func(p *Prometheus) {
+		p.relabels = append(p.relabels, fn)
+	}
+}
+
+// relabel applies the relabel funcs to o, reporting false when one drops it
+func (p *Prometheus) relabel(o *Observation) bool {
+	labels := make(map[string]string, 3+len(o.Labels))
+	for name, value := range o.Labels {
+		labels[name] = value
+	}
+	labels["code"] = o.Code
+	labels["method"] = o.Method
+	labels["path"] = o.Path
+	for _, fn := range p.relabels {
+		if labels = fn(labels); labels == nil {
+			return false
+		}
+	}
+
+	// the funcs may build labels from request data, which must not leak query strings
+	o.Code, o.Method, o.Path = labels["code"], labels["method"], stripPatternQuery(labels["path"])
+	if len(p.labelSources) > 0 {
+		o.Labels = make(prometheus.Labels, len(p.labelSources))
+		for _, source := range p.labelSources {
+			o.Labels[source.name] = stripQuery(labels[source.name])
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,202 @@
+package fasthttpprom
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/valyala/fasthttp"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var defaultRemoteWriteTimeout = 10 * time.Second
+
+// RemoteWriteConfig configures shipping the metrics to a Prometheus remote_write endpoint
+// such as Cortex, Mimir or VictoriaMetrics, for deployments which cannot be scraped
+type RemoteWriteConfig struct {
+	// URL of the remote_write endpoint
+	URL string
+	// Interval between writes. No periodic writes are made when it is zero.
+	Interval time.Duration
+	// Timeout of a single write, 10s if zero
+	Timeout time.Duration
+	// Headers are added to every write request, f.e for authentication or X-Scope-OrgID
+	Headers map[string]string
+	// ExternalLabels are added to every written series
+	ExternalLabels map[string]string
+	// FlushOnClose makes a final write when Close is called
+	FlushOnClose bool
+	// ErrorHandler is called with every failed write. Errors are logged when it is nil.
+	ErrorHandler func(error)
+}
+
+// WithRemoteWrite writes the metrics to a remote_write endpoint every cfg.Interval until
+// Close is called
+func WithRemoteWrite(cfg RemoteWriteConfig) Option {
+	return func(p *Prometheus) {
+		if cfg.Timeout <= 0 {
+			cfg.Timeout = defaultRemoteWriteTimeout
+		}
+		p.remoteWrite = &cfg
+	}
+}
+
+// RemoteWrite sends the current metrics to the endpoint configured with WithRemoteWrite
+func (p *Prometheus) RemoteWrite() error {
+	if p.remoteWrite == nil {
+		return nil
+	}
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		return err
+	}
+	body := encodeWriteRequest(families, p.remoteWrite.ExternalLabels, time.Now().UnixMilli())
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.SetRequestURI(p.remoteWrite.URL)
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.SetContentType("application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for name, value := range p.remoteWrite.Headers {
+		req.Header.Set(name, value)
+	}
+	req.SetBody(s2.EncodeSnappy(nil, body))
+
+	if err := p.remoteWriteClient.DoTimeout(req, resp, p.remoteWrite.Timeout); err != nil {
+		return err
+	}
+	if code := resp.StatusCode(); code/100 != 2 {
+		return fmt.Errorf("remote write: unexpected status code %d", code)
+	}
+
+	return nil
+}
+
+// startRemoteWrite schedules the periodic writes and the configured final write
+func (p *Prometheus) startRemoteWrite() {
+	p.remoteWriteClient = &fasthttp.Client{}
+	write := func() { p.remoteWriteError(p.RemoteWrite()) }
+	var final func()
+	if p.remoteWrite.FlushOnClose {
+		final = write
+	}
+	p.runEvery(p.remoteWrite.Interval, 0, write, final)
+}
+
+func (p *Prometheus) remoteWriteError(err error) {
+	if err == nil {
+		return
+	}
+	if p.remoteWrite.ErrorHandler != nil {
+		p.remoteWrite.ErrorHandler(err)
+		return
+	}
+	log.Printf("Fail to remote write metrics: %s\n", err)
+}
+
+// remoteLabel is a label of a remote_write series
+type remoteLabel struct {
+	name, value string
+}
+
+// encodeWriteRequest encodes the gathered metric families as a remote_write WriteRequest
+// protobuf message. Samples without their own timestamp are stamped with nowMs.
+func encodeWriteRequest(families []*dto.MetricFamily, external map[string]string, nowMs int64) []byte {
+	var buf, series []byte
+	writeSeries := func(name string, base []remoteLabel, extra remoteLabel, value float64, ts int64) {
+		labels := make([]remoteLabel, 0, len(base)+2)
+		labels = append(labels, remoteLabel{"__name__", name})
+		labels = append(labels, base...)
+		if extra.name != "" {
+			labels = append(labels, extra)
+		}
+		sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+
+		series = series[:0]
+		for _, l := range labels {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, l.name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, l.value)
+			series = protowire.AppendTag(series, 1, protowire.BytesType)
+			series = protowire.AppendBytes(series, label)
+		}
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(ts))
+		series = protowire.AppendTag(series, 2, protowire.BytesType)
+		series = protowire.AppendBytes(series, sample)
+
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, series)
+	}
+
+	for _, mf := range families {
+		name := mf.GetName()
+		for _, m := range mf.GetMetric() {
+			base := make([]remoteLabel, 0, len(m.GetLabel())+len(external))
+			for _, lp := range m.GetLabel() {
+				base = append(base, remoteLabel{lp.GetName(), lp.GetValue()})
+			}
+			for n, v := range external {
+				base = append(base, remoteLabel{n, v})
+			}
+			ts := nowMs
+			if m.TimestampMs != nil {
+				ts = m.GetTimestampMs()
+			}
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				writeSeries(name, base, remoteLabel{}, m.GetCounter().GetValue(), ts)
+			case dto.MetricType_GAUGE:
+				writeSeries(name, base, remoteLabel{}, m.GetGauge().GetValue(), ts)
+			case dto.MetricType_UNTYPED:
+				writeSeries(name, base, remoteLabel{}, m.GetUntyped().GetValue(), ts)
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					writeSeries(name, base, remoteLabel{"quantile", formatFloat(q.GetQuantile())}, q.GetValue(), ts)
+				}
+				writeSeries(name+"_sum", base, remoteLabel{}, s.GetSampleSum(), ts)
+				writeSeries(name+"_count", base, remoteLabel{}, float64(s.GetSampleCount()), ts)
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				inf := false
+				for _, b := range h.GetBucket() {
+					inf = inf || math.IsInf(b.GetUpperBound(), 1)
+					writeSeries(name+"_bucket", base, remoteLabel{"le", formatFloat(b.GetUpperBound())}, float64(b.GetCumulativeCount()), ts)
+				}
+				if !inf {
+					writeSeries(name+"_bucket", base, remoteLabel{"le", "+Inf"}, float64(h.GetSampleCount()), ts)
+				}
+				writeSeries(name+"_sum", base, remoteLabel{}, h.GetSampleSum(), ts)
+				writeSeries(name+"_count", base, remoteLabel{}, float64(h.GetSampleCount()), ts)
+			}
+		}
+	}
+
+	return buf
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
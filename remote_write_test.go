@@ -0,0 +1,156 @@
+package fasthttpprom
+
+import (
+	"math"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/s2"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// writtenSeries is a decoded remote_write TimeSeries with a single sample
+type writtenSeries struct {
+	labels    []remoteLabel
+	value     float64
+	timestamp int64
+}
+
+// decodeWriteRequest decodes a WriteRequest message encoded by encodeWriteRequest
+func decodeWriteRequest(t *testing.T, b []byte) []writtenSeries {
+	t.Helper()
+	var written []writtenSeries
+	forEachField(t, b, func(num protowire.Number, v []byte) {
+		var s writtenSeries
+		forEachField(t, v, func(num protowire.Number, v []byte) {
+			switch num {
+			case 1:
+				var l remoteLabel
+				forEachField(t, v, func(num protowire.Number, v []byte) {
+					if num == 1 {
+						l.name = string(v)
+					} else {
+						l.value = string(v)
+					}
+				})
+				s.labels = append(s.labels, l)
+			case 2:
+				value, n := protowire.ConsumeFixed64(v[1:])
+				s.value = math.Float64frombits(value)
+				ts, m := protowire.ConsumeVarint(v[2+n:])
+				if n < 0 || m < 0 {
+					t.Fatalf("invalid sample %x", v)
+				}
+				s.timestamp = int64(ts)
+			}
+		})
+		written = append(written, s)
+	})
+
+	return written
+}
+
+// forEachField calls fn with the number and content of every length-delimited field of b
+func forEachField(t *testing.T, b []byte, fn func(num protowire.Number, v []byte)) {
+	t.Helper()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 || typ != protowire.BytesType {
+			t.Fatalf("invalid field in %x", b)
+		}
+		v, m := protowire.ConsumeBytes(b[n:])
+		if m < 0 {
+			t.Fatalf("invalid field in %x", b)
+		}
+		fn(num, v)
+		b = b[n+m:]
+	}
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	counter := dto.MetricType_COUNTER
+	histogram := dto.MetricType_HISTOGRAM
+	families := []*dto.MetricFamily{
+		{
+			Name: proto.String("requests_total"),
+			Type: &counter,
+			Metric: []*dto.Metric{{
+				Label:       []*dto.LabelPair{{Name: proto.String("path"), Value: proto.String("GET_/")}},
+				Counter:     &dto.Counter{Value: proto.Float64(3)},
+				TimestampMs: proto.Int64(42),
+			}},
+		},
+		{
+			Name: proto.String("duration_seconds"),
+			Type: &histogram,
+			Metric: []*dto.Metric{{
+				Histogram: &dto.Histogram{
+					SampleCount: proto.Uint64(2),
+					SampleSum:   proto.Float64(1.5),
+					Bucket:      []*dto.Bucket{{UpperBound: proto.Float64(1), CumulativeCount: proto.Uint64(1)}},
+				},
+			}},
+		},
+	}
+
+	got := decodeWriteRequest(t, encodeWriteRequest(families, map[string]string{"cluster": "eu"}, 1000))
+	want := []writtenSeries{
+		{labels: []remoteLabel{{"__name__", "requests_total"}, {"cluster", "eu"}, {"path", "GET_/"}}, value: 3, timestamp: 42},
+		{labels: []remoteLabel{{"__name__", "duration_seconds_bucket"}, {"cluster", "eu"}, {"le", "1"}}, value: 1, timestamp: 1000},
+		{labels: []remoteLabel{{"__name__", "duration_seconds_bucket"}, {"cluster", "eu"}, {"le", "+Inf"}}, value: 2, timestamp: 1000},
+		{labels: []remoteLabel{{"__name__", "duration_seconds_sum"}, {"cluster", "eu"}}, value: 1.5, timestamp: 1000},
+		{labels: []remoteLabel{{"__name__", "duration_seconds_count"}, {"cluster", "eu"}}, value: 2, timestamp: 1000},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("written series\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestRemoteWrite(t *testing.T) {
+	ln := fasthttputil.NewInmemoryListener()
+	defer ln.Close()
+	requests := make(chan *fasthttp.Request, 1)
+	go fasthttp.Serve(ln, func(ctx *fasthttp.RequestCtx) {
+		req := &fasthttp.Request{}
+		ctx.Request.CopyTo(req)
+		requests <- req
+		ctx.SetStatusCode(fasthttp.StatusNoContent)
+	})
+	p := NewPrometheus("test_remote_write", WithRemoteWrite(RemoteWriteConfig{
+		URL:     "http://remote/api/v1/write",
+		Headers: map[string]string{"X-Scope-OrgID": "tenant"},
+	}))
+	defer p.Close()
+	p.remoteWriteClient = &fasthttp.Client{Dial: func(string) (net.Conn, error) { return ln.Dial() }}
+
+	if err := p.RemoteWrite(); err != nil {
+		t.Fatal(err)
+	}
+	req := <-requests
+	for name, want := range map[string]string{
+		"Content-Encoding":                  "snappy",
+		"Content-Type":                      "application/x-protobuf",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+		"X-Scope-OrgID":                     "tenant",
+	} {
+		if got := string(req.Header.Peek(name)); got != want {
+			t.Errorf("%s header = %q, want %q", name, got, want)
+		}
+	}
+	body, err := s2.Decode(nil, req.Body())
+	if err != nil {
+		t.Fatalf("body is not snappy compressed: %s", err)
+	}
+	found := false
+	for _, s := range decodeWriteRequest(t, body) {
+		found = found || s.labels[0] == remoteLabel{"__name__", "test_remote_write_config_info"} && s.value == 1
+	}
+	if !found {
+		t.Error("gathered metrics not written")
+	}
+}
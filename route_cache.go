@@ -0,0 +1,69 @@
+package fasthttpprom
+
+import (
+	"container/list"
+	"sync"
+)
+
+// routeCache is a bounded LRU mapping method and request path to the resolved route
+// pattern
+type routeCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type routeCacheEntry struct {
+	key   string
+	match routeMatch
+}
+
+func newRouteCache(size int) *routeCache {
+	return &routeCache{
+		size:    size,
+		entries: make(map[string]*list.Element, size),
+		lru:     list.New(),
+	}
+}
+
+func routeCacheKey(method, path string) string {
+	return method + " " + path
+}
+
+func (c *routeCache) get(key string) (routeMatch, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return routeMatch{}, false
+	}
+	c.lru.MoveToFront(el)
+
+	return el.Value.(*routeCacheEntry).match, true
+}
+
+func (c *routeCache) add(key string, m routeMatch) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*routeCacheEntry).match = m
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&routeCacheEntry{key: key, match: m})
+	if c.lru.Len() > c.size {
+		entry := c.lru.Remove(c.lru.Back()).(*routeCacheEntry)
+		delete(c.entries, entry.key)
+	}
+}
+
+// purge drops every cached resolution
+func (c *routeCache) purge() {
+	c.mu.Lock()
+	c.entries = make(map[string]*list.Element, c.size)
+	c.lru.Init()
+	c.mu.Unlock()
+}
@@ -0,0 +1,56 @@
+package fasthttpprom
+
+import (
+	"testing"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+func TestRouteCacheLRU(t *testing.T) {
+	c := newRouteCache(2)
+	a, b, d := routeCacheKey("GET", "/a"), routeCacheKey("GET", "/b"), routeCacheKey("GET", "/d")
+	c.add(a, routeMatch{pattern: "/a", matched: true})
+	c.add(b, routeMatch{pattern: "/b", matched: true})
+	// reading a makes b the least recently used
+	if m, ok := c.get(a); !ok || m.pattern != "/a" {
+		t.Fatalf("get(%q) = %+v, %v", a, m, ok)
+	}
+	c.add(d, routeMatch{pattern: "/{d}", matched: true})
+	if _, ok := c.get(b); ok {
+		t.Errorf("%q not evicted", b)
+	}
+	for key, want := range map[string]string{a: "/a", d: "/{d}"} {
+		if m, ok := c.get(key); !ok || m.pattern != want {
+			t.Errorf("get(%q) = %+v, %v, want pattern %q", key, m, ok, want)
+		}
+	}
+	// adding a cached key updates it without evicting
+	c.add(a, routeMatch{pattern: "/{a}", matched: true})
+	if m, _ := c.get(a); m.pattern != "/{a}" || c.lru.Len() != 2 {
+		t.Errorf("updated entry %+v with %d entries", m, c.lru.Len())
+	}
+	c.purge()
+	if _, ok := c.get(a); ok || c.lru.Len() != 0 {
+		t.Error("entries left after purge")
+	}
+}
+
+func TestRouteCacheLookups(t *testing.T) {
+	r := router.New()
+	r.GET("/users/{id}", func(ctx *fasthttp.RequestCtx) {})
+	rec := &recorder{}
+	p := newTestPrometheus(t, "test_route_cache", r, WithRouteCache(16), WithBackend(rec))
+
+	for i := 0; i < 3; i++ {
+		serve(p.Handler, fasthttp.MethodGet, "/users/1")
+		if o := rec.last(t); o.Path != "GET_/users/{id}" {
+			t.Errorf("request %d recorded as %q", i, o.Path)
+		}
+	}
+	for result, want := range map[string]float64{"miss": 1, "hit": 2} {
+		if v, _ := metricValue(t, "test_route_cache_route_cache_lookups_total", map[string]string{"result": result}); v != want {
+			t.Errorf("%s lookups = %v, want %v", result, v, want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package fasthttpprom
+
+import "time"
+
+// WithRouteStats keeps the requests of every route over the last window in memory, one
+// second slots in a ring buffer, for RouteStats
+func WithRouteStats(window time.Duration) Option {
+	return func(p *Prometheus) {
+		p.routeStats = newWindowStats(window)
+	}
+}
+
+// RouteStats returns the RPS, error rate and latency quantiles of every route over the
+// window configured with WithRouteStats, sorted by path, so in-process components such
+// as load shedders can act on fresh data. It returns nil without WithRouteStats.
+func (p *Prometheus) RouteStats() []RouteStats {
+	if p.routeStats == nil {
+		return nil
+	}
+
+	return p.routeStats.snapshot(p.clock.Now())
+}
+
+// RouteStat returns the stats of the route with the path label path, f.e "GET_/health",
+// reporting whether it had requests within the window
+func (p *Prometheus) RouteStat(path string) (RouteStats, bool) {
+	for _, rs := range p.RouteStats() {
+		if rs.Path == path {
+			return rs, true
+		}
+	}
+
+	return RouteStats{}, false
+}
@@ -0,0 +1,163 @@
+package fasthttpprom
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+// registeredRoutes returns a snapshot of the patterns registered on the router by method.
+// The snapshot is taken on first use, once the routes registered before serving are in
+// place, and replaced by Handle, so requests never iterate the router's own route list
+// while a route is being registered.
+func (p *Prometheus) registeredRoutes() map[string][]string {
+	if routes := p.routeTable.Load(); routes != nil {
+		return *routes
+	}
+
+	return p.refreshRoutes()
+}
+
+// refreshRoutes replaces the route snapshot and drops the cached resolutions
+func (p *Prometheus) refreshRoutes() map[string][]string {
+	p.routesMu.Lock()
+	defer p.routesMu.Unlock()
+
+	routes := make(map[string][]string)
+	for method, patterns := range p.router.List() {
+		routes[method] = append([]string(nil), patterns...)
+	}
+	p.routeTable.Store(&routes)
+	if p.routes != nil {
+		p.routes.purge()
+	}
+	p.logCardinalityRisks(routes)
+
+	return routes
+}
+
+// routesChanged reports whether routes were registered directly on the router since the
+// snapshot routes was taken, so requests whose route is not resolved don't refresh it
+func (p *Prometheus) routesChanged(routes map[string][]string) bool {
+	p.routesMu.RLock()
+	defer p.routesMu.RUnlock()
+
+	registered := p.router.List()
+	if len(registered) != len(routes) {
+		return true
+	}
+	for method, patterns := range registered {
+		if len(patterns) != len(routes[method]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// patternRegexp returns the regular expression matching the paths of pattern if it has
+// regular expression parameters, f.e /u/{id:[0-9]+}, or nil
+func (p *Prometheus) patternRegexp(pattern string) *regexp.Regexp {
+	if re, ok := p.patternRegexps.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	re := compilePattern(pattern)
+	p.patternRegexps.Store(pattern, re)
+
+	return re
+}
+
+// compilePattern translates a route pattern with regular expression parameters into a
+// regular expression matching its paths like the router does, or returns nil when the
+// pattern has none
+func compilePattern(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+	withRegex := false
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '{' {
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			continue
+		}
+		// parameters end at the brace closing the opening one, regular expressions may
+		// hold braces themselves
+		depth, end := 0, i
+		for end = i + 1; end < len(pattern); end++ {
+			if pattern[end] == '{' {
+				depth++
+			} else if pattern[end] == '}' {
+				if depth == 0 {
+					break
+				}
+				depth--
+			}
+		}
+		if end == len(pattern) {
+			return nil
+		}
+		name, expression, hasExpression := strings.Cut(pattern[i+1:end], ":")
+		switch {
+		case hasExpression && expression == "*":
+			expr.WriteString(".*")
+		case hasExpression:
+			withRegex = true
+			expr.WriteString("(?:" + expression + ")")
+		case strings.HasSuffix(name, "?"):
+			expr.WriteString("[^/]*")
+		default:
+			expr.WriteString("[^/]+")
+		}
+		i = end
+	}
+	if !withRegex {
+		return nil
+	}
+	re, err := regexp.Compile("^" + expr.String() + "/?$")
+	if err != nil {
+		return nil
+	}
+
+	return re
+}
+
+// Handle registers handler for method and path on the instrumented router while serving.
+// The registration waits for the lookups of the requests being dispatched and labeled,
+// so the route trees never change during one, and replaces the route snapshot used to
+// label requests. Routes must not be registered directly on the router while serving.
+func (p *Prometheus) Handle(method, path string, handler fasthttp.RequestHandler) {
+	p.routesMu.Lock()
+	p.router.Handle(method, path, handler)
+	p.routesMu.Unlock()
+	p.refreshRoutes()
+}
+
+// dispatch serves ctx with the router. The handler is looked up under the read lock of
+// the routes and run after releasing it, so Handle is not blocked by slow handlers.
+// Requests without a handler, answered by the router with a redirect, 405 or 404, are
+// served under the lock.
+func (p *Prometheus) dispatch(ctx *fasthttp.RequestCtx) {
+	p.routesMu.RLock()
+	handler, _ := p.router.Lookup(string(ctx.Method()), string(ctx.Request.URI().PathOriginal()), ctx)
+	if handler == nil {
+		defer p.routesMu.RUnlock()
+		p.router.Handler(ctx)
+		return
+	}
+	p.routesMu.RUnlock()
+
+	if panicHandler := p.router.PanicHandler; panicHandler != nil {
+		defer func() {
+			if rcv := recover(); rcv != nil {
+				panicHandler(ctx, rcv)
+			}
+		}()
+	}
+	handler(ctx)
+}
+
+// setRouter instruments r, dropping the route snapshot of the previous router
+func (p *Prometheus) setRouter(r *router.Router) {
+	p.router = r
+	p.routeTable.Store(nil)
+}
@@ -0,0 +1,121 @@
+package fasthttpprom
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+func TestHandleWhileServing(t *testing.T) {
+	r := router.New()
+	r.GET("/users/{id}", func(ctx *fasthttp.RequestCtx) {})
+	rec := &recorder{}
+	p := newTestPrometheus(t, "test_handle_serving", r, WithBackend(rec))
+	// routes are resolved by comparing handlers, the added routes share theirs so only
+	// the route registered before serving is checked for its label
+
+	const routes = 50
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < routes; i++ {
+			p.Handle(fasthttp.MethodGet, fmt.Sprintf("/v%d/{id}", i), func(ctx *fasthttp.RequestCtx) { ctx.SetBodyString("v") })
+		}
+	}()
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				serve(p.Handler, fasthttp.MethodGet, fmt.Sprintf("/users/%d", i))
+				serve(p.Handler, fasthttp.MethodGet, fmt.Sprintf("/v%d/%d", i%routes, w))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	users := 0
+	for _, o := range rec.observations {
+		if o.Path == "GET_/users/{id}" {
+			users++
+		}
+	}
+	if users != 4*200 {
+		t.Errorf("%d requests recorded as GET_/users/{id}, want %d", users, 4*200)
+	}
+	for i := 0; i < routes; i++ {
+		ctx := serve(p.Handler, fasthttp.MethodGet, fmt.Sprintf("/v%d/1", i))
+		if ctx.Response.StatusCode() != fasthttp.StatusOK {
+			t.Fatalf("/v%d/1 answered %d", i, ctx.Response.StatusCode())
+		}
+	}
+}
+
+func TestRouteRegisteredAfterSnapshot(t *testing.T) {
+	r := router.New()
+	r.GET("/a", func(ctx *fasthttp.RequestCtx) {})
+	rec := &recorder{}
+	p := newTestPrometheus(t, "test_route_after_snapshot", r, WithBackend(rec), WithRouteCache(16))
+
+	serve(p.Handler, fasthttp.MethodGet, "/a")
+	r.GET("/b/{id}", func(ctx *fasthttp.RequestCtx) { ctx.SetBodyString("b") })
+	serve(p.Handler, fasthttp.MethodGet, "/b/1")
+	if got := rec.last(t).Path; got != "GET_/b/{id}" {
+		t.Errorf("route registered after the snapshot recorded as %q", got)
+	}
+}
+
+func TestRegexRoutePattern(t *testing.T) {
+	r := router.New()
+	r.GET("/u/{id:[0-9]+}", func(ctx *fasthttp.RequestCtx) {})
+	r.GET("/files/{path:*}", func(ctx *fasthttp.RequestCtx) { ctx.SetBodyString("files") })
+	rec := &recorder{}
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	p := newTestPrometheus(t, "test_regex_route_pattern", r, WithBackend(rec), WithStrictMode())
+	serve(p.Handler, fasthttp.MethodGet, "/files/a")
+	warnings := strings.Count(logs.String(), "cardinality risk")
+
+	for i := 0; i < 10; i++ {
+		serve(p.Handler, fasthttp.MethodGet, fmt.Sprintf("/u/%d", i))
+		if got := rec.last(t).Path; got != "GET_/u/{id:[0-9]+}" {
+			t.Fatalf("/u/%d recorded as %q", i, got)
+		}
+	}
+	// unresolved requests don't refresh the routes, logging their risks again
+	if got := strings.Count(logs.String(), "cardinality risk"); got != warnings {
+		t.Errorf("%d cardinality warnings after serving, want %d", got, warnings)
+	}
+}
+
+func TestCompilePattern(t *testing.T) {
+	for pattern, paths := range map[string]map[string]bool{
+		"/u/{id:[0-9]+}":            {"/u/12": true, "/u/12/": true, "/u/ab": false, "/u/12/x": false},
+		"/d/{day:[0-9]{2}}/{name}":  {"/d/01/x": true, "/d/1/x": false},
+		"/v/{id:[a-z]+}/{rest:*}":   {"/v/ab/c/d": true, "/v/1/c": false},
+		"/o/{id:[0-9]+}/{name?}":    {"/o/1/": true, "/o/1/a": true, "/o/a/a": false},
+		"/literal.json/{id:[0-9]+}": {"/literal.json/1": true, "/literalxjson/1": false},
+	} {
+		re := compilePattern(pattern)
+		if re == nil {
+			t.Fatalf("%s not compiled", pattern)
+		}
+		for path, want := range paths {
+			if got := re.MatchString(path); got != want {
+				t.Errorf("%s matches %s = %v, want %v", pattern, path, got, want)
+			}
+		}
+	}
+	if re := compilePattern("/users/{id}"); re != nil {
+		t.Errorf("pattern without regular expressions compiled to %s", re)
+	}
+}
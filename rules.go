@@ -0,0 +1,395 @@
+package fasthttpprom
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// SLO is the service level objective of a route
+type SLO struct {
+	// Availability is the objective ratio of requests answered without a 5xx code, f.e
+	// 0.999. No availability alerts are generated when it is zero.
+	Availability float64
+	// Latency is the threshold of the latency objective. It has to be one of the
+	// histogram buckets.
+	Latency time.Duration
+	// LatencyTarget is the objective ratio of requests faster than Latency. No latency
+	// alerts are generated when it is zero.
+	LatencyTarget float64
+}
+
+// RulesConfig configures the generated Prometheus rules
+type RulesConfig struct {
+	// SLO applies to the routes without an entry in Routes
+	SLO SLO
+	// Routes holds per route objectives keyed by path label, f.e "GET_/health"
+	Routes map[string]SLO
+	// Labels are added to every generated rule
+	Labels map[string]string
+	// Window is the rate window of the recording rules, 5m if zero
+	Window time.Duration
+	// ErrorCodes is the regular expression of the code labels counted as errors, 5.. if
+	// empty. It is required with WithStatusMapper, whose codes the default may not match.
+	ErrorCodes string
+}
+
+var defaultRulesWindow = "5m"
+
+var defaultErrorCodes = "5.."
+
+// errErrorCodes is returned when generating error rules for remapped codes without
+// RulesConfig.ErrorCodes
+var errErrorCodes = errors.New("fasthttpprom: RulesConfig.ErrorCodes is required with WithStatusMapper")
+
+// burnWindow is a multiwindow burn rate alert, alerting when both windows burn the error
+// budget faster than factor
+type burnWindow struct {
+	long, short, forDur string
+	factor              string
+	severity            string
+}
+
+// burnWindows are the fast and slow burn alerts recommended by the SRE workbook
+var burnWindows = []burnWindow{
+	{long: "1h", short: "5m", forDur: "2m", factor: "14.4", severity: "page"},
+	{long: "6h", short: "30m", forDur: "15m", factor: "6", severity: "ticket"},
+}
+
+type rule struct {
+	Alert       string
+	Record      string
+	Expr        string
+	For         string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+type ruleGroup struct {
+	Name  string
+	Rules []rule
+}
+
+var rulesTemplate = template.Must(template.New("rules").Funcs(template.FuncMap{
+	"quote": quoteYAML,
+}).Parse(`groups:
+{{- range .}}
+- name: {{quote .Name}}
+  rules:
+{{- range .Rules}}
+  - {{if .Alert}}alert: {{quote .Alert}}{{else}}record: {{quote .Record}}{{end}}
+    expr: {{quote .Expr}}
+{{- if .For}}
+    for: {{.For}}
+{{- end}}
+{{- if .Labels}}
+    labels:
+{{- range $name, $value := .Labels}}
+      {{$name}}: {{quote $value}}
+{{- end}}
+{{- end}}
+{{- if .Annotations}}
+    annotations:
+{{- range $name, $value := .Annotations}}
+      {{$name}}: {{quote $value}}
+{{- end}}
+{{- end}}
+{{- end}}
+{{- end}}
+`))
+
+// AlertingRules generates a Prometheus alerting rules file with error budget burn rate
+// alerts for the availability and latency objectives of every registered route
+func (p *Prometheus) AlertingRules(cfg RulesConfig) ([]byte, error) {
+	group, err := p.alertingRules(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return renderRules([]ruleGroup{group})
+}
+
+func (p *Prometheus) alertingRules(cfg RulesConfig) (ruleGroup, error) {
+	codes, codesErr := p.errorCodes(cfg)
+	var rules []rule
+	for _, ep := range p.routeLabels() {
+		slo, ok := cfg.Routes[ep]
+		if !ok {
+			slo = cfg.SLO
+		}
+		method, _, _ := strings.Cut(ep, "_")
+		metric := prometheus.BuildFQName("", p.subsystem, p.durationMetric(method))
+		sel := fmt.Sprintf("path=%q", ep)
+
+		if slo.Availability > 0 {
+			if codesErr != nil {
+				return ruleGroup{}, codesErr
+			}
+			errorRatio := func(window string) string {
+				return fmt.Sprintf(`sum(rate(%s_count{%s,code=~%q}[%s])) / sum(rate(%s_count{%s}[%s]))`,
+					metric, sel, codes, window, metric, sel, window)
+			}
+			for _, w := range burnWindows {
+				threshold := fmt.Sprintf("(%s * (1 - %s))", w.factor, formatFloat(slo.Availability))
+				rules = append(rules, rule{
+					Alert:  "RequestErrorBudgetBurn",
+					Expr:   fmt.Sprintf("%s > %s and %s > %s", errorRatio(w.long), threshold, errorRatio(w.short), threshold),
+					For:    w.forDur,
+					Labels: ruleLabels(cfg.Labels, ep, w.severity),
+					Annotations: map[string]string{
+						"summary": fmt.Sprintf("%s is burning its %s availability error budget %sx too fast", ep, formatFloat(slo.Availability), w.factor),
+					},
+				})
+			}
+		}
+
+		if slo.LatencyTarget > 0 {
+			le, ok := bucketLabel(p.bucketsOf(method), slo.Latency)
+			if !ok {
+				return ruleGroup{}, fmt.Errorf("latency objective %s of %s is not a histogram bucket", slo.Latency, ep)
+			}
+			slowRatio := func(window string) string {
+				return fmt.Sprintf(`1 - sum(rate(%s_bucket{%s,le=%q}[%s])) / sum(rate(%s_count{%s}[%s]))`,
+					metric, sel, le, window, metric, sel, window)
+			}
+			for _, w := range burnWindows {
+				threshold := fmt.Sprintf("(%s * (1 - %s))", w.factor, formatFloat(slo.LatencyTarget))
+				rules = append(rules, rule{
+					Alert:  "RequestLatencyBudgetBurn",
+					Expr:   fmt.Sprintf("%s > %s and %s > %s", slowRatio(w.long), threshold, slowRatio(w.short), threshold),
+					For:    w.forDur,
+					Labels: ruleLabels(cfg.Labels, ep, w.severity),
+					Annotations: map[string]string{
+						"summary": fmt.Sprintf("%s is burning its %s under %s latency error budget %sx too fast", ep, formatFloat(slo.LatencyTarget), slo.Latency, w.factor),
+					},
+				})
+			}
+		}
+	}
+
+	return ruleGroup{Name: "request-slo-alerts", Rules: rules}, nil
+}
+
+// RecordingRules generates a Prometheus recording rules file precomputing the p99
+// latency, error ratio and request rate of every path over cfg.Window
+func (p *Prometheus) RecordingRules(cfg RulesConfig) ([]byte, error) {
+	group, err := p.recordingRules(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return renderRules([]ruleGroup{group})
+}
+
+func (p *Prometheus) recordingRules(cfg RulesConfig) (ruleGroup, error) {
+	metric := prometheus.BuildFQName("", p.subsystem, defaultDurationMetric)
+	codes, err := p.errorCodes(cfg)
+	if err != nil {
+		return ruleGroup{}, err
+	}
+	window := defaultRulesWindow
+	if cfg.Window > 0 {
+		window = promDuration(cfg.Window)
+	}
+	record := func(name string) string {
+		return fmt.Sprintf("path:%s:%s_rate%s", metric, name, window)
+	}
+
+	return ruleGroup{
+		Name: "request-recording-rules",
+		Rules: []rule{
+			{
+				Record: record("p99"),
+				Expr:   fmt.Sprintf("histogram_quantile(0.99, sum by (path, le) (rate(%s[%s])))", p.durationSeries("_bucket", ""), window),
+				Labels: cfg.Labels,
+			},
+			{
+				Record: record("error_ratio"),
+				Expr: fmt.Sprintf(`sum by (path) (rate(%s[%s])) / sum by (path) (rate(%s[%s]))`,
+					p.durationSeries("_count", fmt.Sprintf("code=~%q", codes)), window, p.durationSeries("_count", ""), window),
+				Labels: cfg.Labels,
+			},
+			{
+				Record: record("requests"),
+				Expr:   fmt.Sprintf("sum by (path) (rate(%s[%s]))", p.durationSeries("_count", ""), window),
+				Labels: cfg.Labels,
+			},
+		},
+	}, nil
+}
+
+// durationSeries selects the series with suffix, f.e _count, of the histograms recording
+// the requests, matching matchers if not empty. The histograms of WithMethodBuckets are
+// selected by name next to request_duration_seconds, each path being in a single one.
+func (p *Prometheus) durationSeries(suffix, matchers string) string {
+	names := []string{prometheus.BuildFQName("", p.subsystem, defaultDurationMetric) + suffix}
+	for method := range p.methodReqDur {
+		names = append(names, prometheus.BuildFQName("", p.subsystem, methodMetricName(method))+suffix)
+	}
+	if len(names) == 1 {
+		if matchers == "" {
+			return names[0]
+		}
+		return names[0] + "{" + matchers + "}"
+	}
+	sort.Strings(names[1:])
+	sel := fmt.Sprintf("__name__=~%q", strings.Join(names, "|"))
+	if matchers != "" {
+		sel += "," + matchers
+	}
+
+	return "{" + sel + "}"
+}
+
+// errorCodes returns the code label regular expression of the requests counted as errors
+func (p *Prometheus) errorCodes(cfg RulesConfig) (string, error) {
+	switch {
+	case cfg.ErrorCodes != "":
+		return cfg.ErrorCodes, nil
+	case p.statusMapper != nil:
+		return "", errErrorCodes
+	}
+
+	return defaultErrorCodes, nil
+}
+
+// RulesHandler serves the alerting and recording rules generated for cfg as a single
+// rules file, f.e from an admin endpoint
+func (p *Prometheus) RulesHandler(cfg RulesConfig) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		alerts, err := p.alertingRules(cfg)
+		var recording ruleGroup
+		if err == nil {
+			recording, err = p.recordingRules(cfg)
+		}
+		var rules []byte
+		if err == nil {
+			rules, err = renderRules([]ruleGroup{alerts, recording})
+		}
+		if err != nil {
+			log.Printf("Fail to generate rules: %s\n", err)
+			ctx.Error(fasthttp.StatusMessage(fasthttp.StatusInternalServerError), fasthttp.StatusInternalServerError)
+			return
+		}
+		ctx.SetContentType("application/yaml")
+		ctx.SetBody(rules)
+	}
+}
+
+// routeLabels returns the path labels of the registered routes, except the endpoints
+// served by the middleware itself. Routes registered for any method are recorded with
+// the method of each request, so they are expanded into every method label.
+func (p *Prometheus) routeLabels() []string {
+	if p.router == nil {
+		return nil
+	}
+	routes := p.registeredRoutes()
+	seen := make(map[string]struct{})
+	var labels []string
+	for method, patterns := range routes {
+		methods := []string{method}
+		if method == router.MethodWild {
+			methods = p.wildMethods(routes)
+		}
+		for _, pattern := range patterns {
+			if p.isOwnEndpoint(pattern) {
+				continue
+			}
+			for _, m := range methods {
+				label := routeLabel(m, pattern)
+				if _, ok := seen[label]; !ok {
+					seen[label] = struct{}{}
+					labels = append(labels, label)
+				}
+			}
+		}
+	}
+	sort.Strings(labels)
+
+	return labels
+}
+
+// wildMethods returns the method labels of the requests served by routes registered for
+// any method: the standard methods, the custom methods of routes and other
+func (p *Prometheus) wildMethods(routes map[string][]string) []string {
+	methods := []string{
+		fasthttp.MethodGet, fasthttp.MethodHead, fasthttp.MethodPost, fasthttp.MethodPut,
+		fasthttp.MethodPatch, fasthttp.MethodDelete, fasthttp.MethodConnect,
+		fasthttp.MethodOptions, fasthttp.MethodTrace, otherMethod,
+	}
+	standard := make(map[string]struct{}, len(methods))
+	for _, method := range methods {
+		standard[method] = struct{}{}
+	}
+	var custom []string
+	for method := range routes {
+		if _, ok := standard[method]; !ok && p.methodLabel(method) == method {
+			custom = append(custom, method)
+		}
+	}
+	sort.Strings(custom)
+
+	return append(methods, custom...)
+}
+
+// promDuration formats d as a Prometheus duration
+func promDuration(d time.Duration) string {
+	if d%time.Minute == 0 {
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+
+	return fmt.Sprintf("%ds", (d+time.Second-1)/time.Second)
+}
+
+// bucketLabel returns the le label of the bucket of buckets with upper bound d
+func bucketLabel(buckets []float64, d time.Duration) (string, bool) {
+	for _, b := range buckets {
+		if b == d.Seconds() {
+			return formatFloat(b), true
+		}
+	}
+
+	return "", false
+}
+
+func ruleLabels(base map[string]string, path, severity string) map[string]string {
+	labels := make(map[string]string, len(base)+2)
+	for name, value := range base {
+		labels[name] = value
+	}
+	labels["path"] = path
+	labels["severity"] = severity
+
+	return labels
+}
+
+// quoteYAML quotes s as a JSON string, which is a valid YAML double quoted scalar
+func quoteYAML(s string) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return "", err
+	}
+
+	return string(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))), nil
+}
+
+func renderRules(groups []ruleGroup) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := rulesTemplate.Execute(&buf, groups); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
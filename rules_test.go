@@ -0,0 +1,111 @@
+package fasthttpprom
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+func TestRulesErrorCodes(t *testing.T) {
+	mapper := func(code int) string {
+		if code >= 500 {
+			return "5xx"
+		}
+		return "ok"
+	}
+	for _, tc := range []struct {
+		name    string
+		opts    []Option
+		codes   string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", want: `code=~\"5..\"`},
+		{name: "configured", codes: "5..|429", want: `code=~\"5..|429\"`},
+		{name: "mapper", opts: []Option{WithStatusMapper(mapper)}, wantErr: true},
+		{name: "mapper_codes", opts: []Option{WithStatusMapper(mapper)}, codes: "5xx", want: `code=~\"5xx\"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := NewPrometheus("test_rules_"+tc.name, tc.opts...)
+			defer p.Close()
+			r := router.New()
+			r.GET("/users", func(*fasthttp.RequestCtx) {})
+			if err := p.Use(r); err != nil {
+				t.Fatal(err)
+			}
+			cfg := RulesConfig{SLO: SLO{Availability: 0.999}, ErrorCodes: tc.codes}
+
+			alerts, err := p.AlertingRules(cfg)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("alerting rules generated for remapped codes")
+				}
+				if _, err := p.RecordingRules(cfg); err == nil {
+					t.Fatal("recording rules generated for remapped codes")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			recording, err := p.RecordingRules(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, rules := range [][]byte{alerts, recording} {
+				if !strings.Contains(string(rules), tc.want) {
+					t.Errorf("rules do not select %s:\n%s", tc.want, rules)
+				}
+			}
+		})
+	}
+}
+
+func TestAlertingRulesAnyRoute(t *testing.T) {
+	p := NewPrometheus("test_rules_any_route")
+	defer p.Close()
+	r := router.New()
+	r.ANY("/proxy", func(*fasthttp.RequestCtx) {})
+	r.Handle("PURGE", "/cache", func(*fasthttp.RequestCtx) {})
+	if err := p.Use(r); err != nil {
+		t.Fatal(err)
+	}
+
+	alerts, err := p.AlertingRules(RulesConfig{SLO: SLO{Availability: 0.999}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(alerts), router.MethodWild+"_") {
+		t.Errorf("rules select the any method label:\n%s", alerts)
+	}
+	for _, method := range []string{fasthttp.MethodGet, fasthttp.MethodDelete, otherMethod, "PURGE"} {
+		if want := `path=\"` + method + `_/proxy\"`; !strings.Contains(string(alerts), want) {
+			t.Errorf("rules do not select %s", want)
+		}
+	}
+}
+
+func TestRecordingRulesAnyRoute(t *testing.T) {
+	r := router.New()
+	r.ANY("/proxy", func(*fasthttp.RequestCtx) {})
+	p := newTestPrometheus(t, "test_recording_rules_any_route", r)
+
+	serve(p.Handler, fasthttp.MethodDelete, "/proxy")
+	if _, ok := metricValue(t, "test_recording_rules_any_route_request_duration_seconds", map[string]string{"path": "DELETE_/proxy"}); !ok {
+		t.Fatal("DELETE_/proxy not recorded")
+	}
+	recording, err := p.RecordingRules(RulesConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the rules aggregate by path without selecting paths, covering the method labels
+	// of the route
+	if strings.Contains(string(recording), "path=") || strings.Contains(string(recording), router.MethodWild+"_") {
+		t.Errorf("recording rules select paths:\n%s", recording)
+	}
+	if !strings.Contains(string(recording), "sum by (path)") {
+		t.Errorf("recording rules don't aggregate by path:\n%s", recording)
+	}
+}
@@ -0,0 +1,44 @@
+package fasthttpprom
+
+import (
+	"math/rand"
+	"time"
+)
+
+// runEvery starts a goroutine calling tick every interval, delayed by up to jitter, until
+// Close is called. final, if not nil, is called once the loop stops. Close waits for it.
+func (p *Prometheus) runEvery(interval, jitter time.Duration, tick, final func()) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		if interval > 0 && tick != nil {
+			timer := time.NewTimer(jitterDelay(interval, jitter))
+			defer timer.Stop()
+		loop:
+			for {
+				select {
+				case <-timer.C:
+					tick()
+					timer.Reset(jitterDelay(interval, jitter))
+				case <-p.done:
+					break loop
+				}
+			}
+		} else {
+			<-p.done
+		}
+
+		if final != nil {
+			final()
+		}
+	}()
+}
+
+func jitterDelay(interval, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+
+	return interval + time.Duration(rand.Int63n(int64(jitter)))
+}
@@ -0,0 +1,92 @@
+package fasthttpprom
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// seriesTracker remembers when each label combination was last observed, ordered from
+// most to least recently observed
+type seriesTracker struct {
+	mu      sync.Mutex
+	max     int
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type seriesEntry struct {
+	key      string
+	labels   []string
+	lastSeen time.Time
+}
+
+func newSeriesTracker(max int) *seriesTracker {
+	return &seriesTracker{
+		max:     max,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// observe marks labels as seen at now and returns the label combinations evicted to keep
+// the number of live series within max
+func (t *seriesTracker) observe(labels []string, now time.Time) [][]string {
+	key := strings.Join(labels, "\xff")
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if el, ok := t.entries[key]; ok {
+		el.Value.(*seriesEntry).lastSeen = now
+		t.lru.MoveToFront(el)
+		return nil
+	}
+	t.entries[key] = t.lru.PushFront(&seriesEntry{
+		key:      key,
+		labels:   append([]string(nil), labels...),
+		lastSeen: now,
+	})
+
+	var evicted [][]string
+	for t.max > 0 && t.lru.Len() > t.max {
+		evicted = append(evicted, t.removeElement(t.lru.Back()))
+	}
+
+	return evicted
+}
+
+func (t *seriesTracker) removeElement(el *list.Element) []string {
+	entry := t.lru.Remove(el).(*seriesEntry)
+	delete(t.entries, entry.key)
+
+	return entry.labels
+}
+
+// expire removes and returns the label combinations last observed before deadline
+func (t *seriesTracker) expire(deadline time.Time) [][]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var expired [][]string
+	for el := t.lru.Back(); el != nil && el.Value.(*seriesEntry).lastSeen.Before(deadline); el = t.lru.Back() {
+		expired = append(expired, t.removeElement(el))
+	}
+
+	return expired
+}
+
+// forget removes every tracked label combination for which match returns true
+func (t *seriesTracker) forget(match func(labels []string) bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for el := t.lru.Front(); el != nil; {
+		next := el.Next()
+		if match(el.Value.(*seriesEntry).labels) {
+			t.removeElement(el)
+		}
+		el = next
+	}
+}
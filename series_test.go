@@ -0,0 +1,54 @@
+package fasthttpprom
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+func TestSeriesTrackerEviction(t *testing.T) {
+	tr := newSeriesTracker(2)
+	start := time.Unix(0, 0)
+	a, b, c := []string{"200", "GET_/a"}, []string{"200", "GET_/b"}, []string{"200", "GET_/c"}
+
+	if evicted := tr.observe(a, start); evicted != nil {
+		t.Fatalf("evicted %v below the maximum", evicted)
+	}
+	tr.observe(b, start.Add(time.Second))
+	// observing a again makes b the least recently observed
+	tr.observe(a, start.Add(2*time.Second))
+	if evicted := tr.observe(c, start.Add(3*time.Second)); !reflect.DeepEqual(evicted, [][]string{b}) {
+		t.Errorf("evicted %v, want %v", evicted, [][]string{b})
+	}
+	// the tracker keeps its own copy of the labels
+	a[1] = "GET_/changed"
+	if expired := tr.expire(start.Add(3 * time.Second)); !reflect.DeepEqual(expired, [][]string{{"200", "GET_/a"}}) {
+		t.Errorf("expired %v, want the series of /a", expired)
+	}
+	tr.forget(func(labels []string) bool { return labels[1] == "GET_/c" })
+	if tr.lru.Len() != 0 || len(tr.entries) != 0 {
+		t.Errorf("%d series tracked after forgetting the last one", tr.lru.Len())
+	}
+}
+
+func TestMaxSeries(t *testing.T) {
+	r := router.New()
+	r.GET("/status", func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(ctx.QueryArgs().GetUintOrZero("code"))
+	})
+	p := newTestPrometheus(t, "test_max_series", r, WithMaxSeries(2))
+
+	for _, uri := range []string{"/status?code=200", "/status?code=404", "/status?code=500"} {
+		serve(p.Handler, fasthttp.MethodGet, uri)
+	}
+	series := gatheredLabels(t, "test_max_series_request_duration_seconds")
+	if len(series) != 2 || series[0]["code"] == "200" || series[1]["code"] == "200" {
+		t.Errorf("exported %v, want the series of the last two codes", series)
+	}
+	if v, _ := metricValue(t, "test_max_series_series_evictions_total", nil); v != 1 {
+		t.Errorf("evictions = %v, want 1", v)
+	}
+}
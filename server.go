@@ -0,0 +1,249 @@
+package fasthttpprom
+
+import (
+	"bytes"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// ServerCollector exports the connection and concurrency statistics of a fasthttp.Server
+// at scrape time
+type ServerCollector struct {
+	server      *fasthttp.Server
+	connections atomic.Uint64
+	requests    atomic.Uint64
+	perIP       atomic.Uint64
+	overLimit   atomic.Uint64
+	timeouts    atomic.Uint64
+	limitHits   atomic.Uint64
+	peak        peakWindow
+
+	openConns   *prometheus.Desc
+	concurrency *prometheus.Desc
+	peakConc    *prometheus.Desc
+	limit       *prometheus.Desc
+	limitHit    *prometheus.Desc
+	utilization *prometheus.Desc
+	connsTotal  *prometheus.Desc
+	reqsTotal   *prometheus.Desc
+	rejections  *prometheus.Desc
+}
+
+// NewServerCollector registers a collector of the statistics of s under subsystem. It
+// wraps s.Handler, s.ConnState and s.ErrorHandler to count the served requests and
+// connections and the read timeouts, so it has to be called after they are set and
+// before s starts serving.
+func NewServerCollector(s *fasthttp.Server, subsystem string) *ServerCollector {
+	c := &ServerCollector{
+		server:      s,
+		openConns:   serverDesc(subsystem, "server_open_connections", "currently open connections"),
+		concurrency: serverDesc(subsystem, "server_concurrency", "connections currently being served"),
+		peakConc:    serverDesc(subsystem, "server_concurrency_max", "most connections served at once over the last one to two minutes"),
+		limit:       serverDesc(subsystem, "server_concurrency_limit", "maximum number of concurrently served connections"),
+		limitHit:    serverDesc(subsystem, "server_concurrency_limit_hits_total", "requests served with the concurrency limit reached"),
+		utilization: serverDesc(subsystem, "server_concurrency_utilization", "ratio of the concurrency limit in use"),
+		connsTotal:  serverDesc(subsystem, "server_connections_total", "served connections"),
+		reqsTotal:   serverDesc(subsystem, "server_requests_total", "served requests"),
+		rejections: prometheus.NewDesc(prometheus.BuildFQName("", subsystem, "server_rejections_total"),
+			"connections and requests rejected by the server itself by reason", []string{"reason"}, nil),
+	}
+
+	connState := s.ConnState
+	s.ConnState = func(conn net.Conn, state fasthttp.ConnState) {
+		if state == fasthttp.StateNew {
+			c.connections.Add(1)
+		}
+		if connState != nil {
+			connState(conn, state)
+		}
+	}
+	if handler := s.Handler; handler != nil {
+		s.Handler = func(ctx *fasthttp.RequestCtx) {
+			c.requests.Add(1)
+			c.observeConcurrency()
+			handler(ctx)
+		}
+	}
+	errorHandler := s.ErrorHandler
+	if errorHandler == nil {
+		errorHandler = defaultErrorHandler
+	}
+	s.ErrorHandler = func(ctx *fasthttp.RequestCtx, err error) {
+		if requestErrorReason(err) == "timeout" {
+			c.timeouts.Add(1)
+		}
+		errorHandler(ctx, err)
+	}
+	prometheus.Register(c)
+
+	return c
+}
+
+func serverDesc(subsystem, name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName("", subsystem, name), help, nil, nil)
+}
+
+// Describe implements prometheus.Collector
+func (c *ServerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.openConns
+	ch <- c.concurrency
+	ch <- c.peakConc
+	ch <- c.limit
+	ch <- c.limitHit
+	ch <- c.utilization
+	ch <- c.connsTotal
+	ch <- c.reqsTotal
+	ch <- c.rejections
+}
+
+// Collect implements prometheus.Collector
+func (c *ServerCollector) Collect(ch chan<- prometheus.Metric) {
+	limit := c.concurrencyLimit()
+	concurrency := c.server.GetCurrentConcurrency()
+	current := float64(concurrency)
+	peak := c.peak.highest(time.Now())
+	if peak < concurrency {
+		peak = concurrency
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.openConns, prometheus.GaugeValue, float64(c.server.GetOpenConnectionsCount()))
+	ch <- prometheus.MustNewConstMetric(c.concurrency, prometheus.GaugeValue, current)
+	ch <- prometheus.MustNewConstMetric(c.peakConc, prometheus.GaugeValue, float64(peak))
+	ch <- prometheus.MustNewConstMetric(c.limit, prometheus.GaugeValue, float64(limit))
+	ch <- prometheus.MustNewConstMetric(c.limitHit, prometheus.CounterValue, float64(c.limitHits.Load()))
+	ch <- prometheus.MustNewConstMetric(c.utilization, prometheus.GaugeValue, current/float64(limit))
+	ch <- prometheus.MustNewConstMetric(c.connsTotal, prometheus.CounterValue, float64(c.connections.Load()))
+	ch <- prometheus.MustNewConstMetric(c.reqsTotal, prometheus.CounterValue, float64(c.requests.Load()))
+	ch <- prometheus.MustNewConstMetric(c.rejections, prometheus.CounterValue, float64(c.overLimit.Load()), "concurrency")
+	ch <- prometheus.MustNewConstMetric(c.rejections, prometheus.CounterValue, float64(c.perIP.Load()), "per_ip")
+	ch <- prometheus.MustNewConstMetric(c.rejections, prometheus.CounterValue, float64(c.timeouts.Load()), "read_timeout")
+}
+
+// concurrencyLimit returns the Concurrency of the server, or fasthttp's default
+func (c *ServerCollector) concurrencyLimit() int {
+	if c.server.Concurrency <= 0 {
+		return fasthttp.DefaultConcurrency
+	}
+
+	return c.server.Concurrency
+}
+
+// observeConcurrency keeps the highest concurrency seen by a request, so bursts between
+// scrapes show up against the limit, and counts the requests served at the limit
+func (c *ServerCollector) observeConcurrency() {
+	current := c.server.GetCurrentConcurrency()
+	if int(current) >= c.concurrencyLimit() {
+		c.limitHits.Add(1)
+	}
+	c.peak.observe(time.Now(), current)
+}
+
+// peakWindowSize is the length of the intervals the peak concurrency is kept for
+const peakWindowSize = time.Minute
+
+// peakWindow keeps the highest value of the current and the previous interval, so every
+// scrape sees the peaks of the last one to two intervals whoever scraped before
+type peakWindow struct {
+	intervals [2]peakInterval
+}
+
+// peakInterval is the highest value seen during the interval numbered epoch
+type peakInterval struct {
+	epoch atomic.Int64
+	peak  atomic.Uint32
+}
+
+// observe records v seen at now
+func (w *peakWindow) observe(now time.Time, v uint32) {
+	epoch := now.UnixNano() / int64(peakWindowSize)
+	interval := &w.intervals[epoch%2]
+	if last := interval.epoch.Load(); last != epoch && interval.epoch.CompareAndSwap(last, epoch) {
+		// the interval is reused two intervals later
+		interval.peak.Store(0)
+	}
+	for {
+		peak := interval.peak.Load()
+		if v <= peak || interval.peak.CompareAndSwap(peak, v) {
+			return
+		}
+	}
+}
+
+// highest returns the highest value seen during the interval of now and the previous one
+func (w *peakWindow) highest(now time.Time) uint32 {
+	epoch := now.UnixNano() / int64(peakWindowSize)
+	var highest uint32
+	for i := range w.intervals {
+		interval := &w.intervals[i]
+		if e := interval.epoch.Load(); e != epoch && e != epoch-1 {
+			continue
+		}
+		if peak := interval.peak.Load(); peak > highest {
+			highest = peak
+		}
+	}
+
+	return highest
+}
+
+// Listener wraps ln to count the connections the server rejects because of Concurrency
+// or MaxConnsPerIP, which are answered before any request is read. Serve s on the
+// returned listener.
+func (c *ServerCollector) Listener(ln net.Listener) net.Listener {
+	return &rejectionListener{Listener: ln, c: c}
+}
+
+// rejectionListener detects the connections rejected by the server
+type rejectionListener struct {
+	net.Listener
+	c *ServerCollector
+}
+
+func (l *rejectionListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return &rejectionConn{Conn: conn, c: l.c}, nil
+}
+
+// rejectionConn counts the concurrency or per IP limit rejection written before the first
+// read.
+// fasthttp only writes to a connection before reading a request to reject it.
+type rejectionConn struct {
+	net.Conn
+	c       *ServerCollector
+	checked bool
+}
+
+func (c *rejectionConn) Read(b []byte) (int, error) {
+	c.checked = true
+	return c.Conn.Read(b)
+}
+
+func (c *rejectionConn) Write(b []byte) (int, error) {
+	if !c.checked {
+		c.checked = true
+		switch {
+		case bytes.HasPrefix(b, concurrencyRejection):
+			c.c.overLimit.Add(1)
+		case bytes.HasPrefix(b, perIPRejection):
+			c.c.perIP.Add(1)
+		}
+	}
+
+	return c.Conn.Write(b)
+}
+
+// concurrencyRejection is the status line of the responses rejecting connections over
+// the Concurrency limit
+var concurrencyRejection = []byte("HTTP/1.1 503 ")
+
+// perIPRejection is the status line of the responses rejecting connections over the
+// MaxConnsPerIP limit
+var perIPRejection = []byte("HTTP/1.1 429 ")
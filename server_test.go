@@ -0,0 +1,84 @@
+package fasthttpprom
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func TestPeakWindow(t *testing.T) {
+	var w peakWindow
+	start := time.Unix(0, 0)
+	w.observe(start, 5)
+	w.observe(start.Add(time.Second), 3)
+
+	// scrapes don't reset the peak, every scraper sees it
+	for i := 0; i < 2; i++ {
+		if got := w.highest(start.Add(2 * time.Second)); got != 5 {
+			t.Errorf("scrape %d saw peak %d, want 5", i, got)
+		}
+	}
+	if got := w.highest(start.Add(peakWindowSize)); got != 5 {
+		t.Errorf("peak in the next interval = %d, want 5", got)
+	}
+	w.observe(start.Add(peakWindowSize), 2)
+	if got := w.highest(start.Add(2 * peakWindowSize)); got != 2 {
+		t.Errorf("peak two intervals later = %d, want 2", got)
+	}
+	w.observe(start.Add(2*peakWindowSize), 1)
+	if got := w.highest(start.Add(2 * peakWindowSize)); got != 2 {
+		t.Errorf("peak after reusing the first interval = %d, want 2", got)
+	}
+}
+
+func TestConcurrencyLimitHits(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	s := &fasthttp.Server{
+		Concurrency: 1,
+		Handler: func(ctx *fasthttp.RequestCtx) {
+			close(entered)
+			<-release
+		},
+	}
+	c := NewServerCollector(s, "test_server_limit")
+	ln := fasthttputil.NewInmemoryListener()
+	defer ln.Close()
+	go s.Serve(c.Listener(ln))
+
+	served, err := ln.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer served.Close()
+	if _, err := served.Write([]byte("GET / HTTP/1.1\r\nHost: test\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	<-entered
+	rejected, err := ln.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rejected.Close()
+	status, err := bufio.NewReader(rejected).ReadString('\n')
+	if err != nil || !strings.HasPrefix(status, "HTTP/1.1 503 ") {
+		t.Fatalf("connection over the limit answered %q, %v", status, err)
+	}
+	close(release)
+	if _, err := bufio.NewReader(served).ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := metricValue(t, "test_server_limit_server_concurrency_limit_hits_total", nil); v != 1 {
+		t.Errorf("limit hits = %v, want 1", v)
+	}
+	if v, _ := metricValue(t, "test_server_limit_server_rejections_total", map[string]string{"reason": "concurrency"}); v != 1 {
+		t.Errorf("concurrency rejections = %v, want 1", v)
+	}
+	if v, _ := metricValue(t, "test_server_limit_server_concurrency_max", nil); v != 1 {
+		t.Errorf("peak concurrency = %v, want 1", v)
+	}
+}
@@ -0,0 +1,32 @@
+package fasthttpprom
+
+import (
+	"strconv"
+
+	"github.com/valyala/fasthttp"
+)
+
+// WithShadowLabel labels every request with shadow="true" when it carries the header
+// set by a traffic mirroring setup, f.e X-Shadow: 1, and shadow="false" otherwise, so
+// mirrored load can be excluded from SLOs. Headers valued "0" or "false" are ignored.
+func WithShadowLabel(header string) Option {
+	return func(p *Prometheus) {
+		p.labelSources = append(p.labelSources, labelSource{
+			name: "shadow",
+			extract: func(ctx *fasthttp.RequestCtx) string {
+				return strconv.FormatBool(isShadow(ctx.Request.Header.Peek(header)))
+			},
+			values: 2,
+		})
+	}
+}
+
+// isShadow reports whether the value of the shadow header marks a mirrored request
+func isShadow(v []byte) bool {
+	switch string(v) {
+	case "", "0", "false":
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,146 @@
+package fasthttpprom
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// samplesPerRoute bounds the durations kept per route for the quantiles of the shutdown
+// report
+const samplesPerRoute = 1024
+
+// ReportFormat is the format of the shutdown report
+type ReportFormat int
+
+const (
+	// ReportJSON writes the report as a JSON array
+	ReportJSON ReportFormat = iota
+	// ReportCSV writes the report as CSV with a header row
+	ReportCSV
+)
+
+// ShutdownReportConfig configures the report written on Close
+type ShutdownReportConfig struct {
+	// Writer the report is written to
+	Writer io.Writer
+	// Format of the report, JSON by default
+	Format ReportFormat
+}
+
+// WithShutdownReport writes the request count, error count and latency quantiles of every
+// route seen during the process lifetime to cfg.Writer when Close is called, for batch
+// jobs and load tests which terminate before a final scrape. The quantiles are estimated
+// from a uniform sample of the durations of every route.
+func WithShutdownReport(cfg ShutdownReportConfig) Option {
+	return func(p *Prometheus) {
+		p.shutdownReport = &shutdownReport{cfg: cfg, routes: make(map[string]*lifetimeRoute)}
+	}
+}
+
+// shutdownReport keeps per-route counts and duration samples over the process lifetime
+type shutdownReport struct {
+	cfg    ShutdownReportConfig
+	mu     sync.Mutex
+	routes map[string]*lifetimeRoute
+}
+
+type lifetimeRoute struct {
+	requests  int64
+	errors    int64
+	durations []time.Duration
+}
+
+// routeReport is a line of the shutdown report
+type routeReport struct {
+	Path     string  `json:"path"`
+	Requests int64   `json:"requests"`
+	Errors   int64   `json:"errors"`
+	P50      float64 `json:"p50_seconds"`
+	P90      float64 `json:"p90_seconds"`
+	P99      float64 `json:"p99_seconds"`
+}
+
+// Record implements MetricsBackend. Requests answered with a 5xx code count as errors.
+func (r *shutdownReport) Record(o Observation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	route, ok := r.routes[o.Path]
+	if !ok {
+		route = &lifetimeRoute{}
+		r.routes[o.Path] = route
+	}
+	route.requests++
+	if len(o.Code) == 3 && o.Code[0] == '5' {
+		route.errors++
+	}
+	// reservoir sampling keeps a uniform sample of the lifetime durations
+	if len(route.durations) < samplesPerRoute {
+		route.durations = append(route.durations, o.Duration)
+	} else if i := rand.Int63n(route.requests); i < samplesPerRoute {
+		route.durations[i] = o.Duration
+	}
+}
+
+// summary returns the report of every route, sorted by path
+func (r *shutdownReport) summary() []routeReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reports := make([]routeReport, 0, len(r.routes))
+	for path, route := range r.routes {
+		sorted := append([]time.Duration(nil), route.durations...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		reports = append(reports, routeReport{
+			Path:     path,
+			Requests: route.requests,
+			Errors:   route.errors,
+			P50:      quantile(sorted, 0.5).Seconds(),
+			P90:      quantile(sorted, 0.9).Seconds(),
+			P99:      quantile(sorted, 0.99).Seconds(),
+		})
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Path < reports[j].Path })
+
+	return reports
+}
+
+// write writes the report in the configured format
+func (r *shutdownReport) write() error {
+	reports := r.summary()
+	if r.cfg.Format != ReportCSV {
+		return json.NewEncoder(r.cfg.Writer).Encode(reports)
+	}
+
+	w := csv.NewWriter(r.cfg.Writer)
+	w.Write([]string{"path", "requests", "errors", "p50_seconds", "p90_seconds", "p99_seconds"})
+	for _, report := range reports {
+		w.Write([]string{
+			report.Path,
+			strconv.FormatInt(report.Requests, 10),
+			strconv.FormatInt(report.Errors, 10),
+			strconv.FormatFloat(report.P50, 'g', -1, 64),
+			strconv.FormatFloat(report.P90, 'g', -1, 64),
+			strconv.FormatFloat(report.P99, 'g', -1, 64),
+		})
+	}
+	w.Flush()
+
+	return w.Error()
+}
+
+// startShutdownReport schedules writing the report once Close is called
+func (p *Prometheus) startShutdownReport() {
+	p.runEvery(0, 0, nil, func() {
+		if err := p.shutdownReport.write(); err != nil {
+			log.Printf("Fail to write shutdown report: %s\n", err)
+		}
+	})
+}
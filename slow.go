@@ -0,0 +1,55 @@
+package fasthttpprom
+
+import (
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// SlowRequestFunc is called with the request, its path label and its duration
+type SlowRequestFunc func(ctx *fasthttp.RequestCtx, route string, dur time.Duration)
+
+// slowHook calls fn for requests taking longer than threshold
+type slowHook struct {
+	threshold time.Duration
+	fn        SlowRequestFunc
+}
+
+// WithSlowRequestCallback calls fn after every recorded request which took longer than
+// threshold, f.e to emit traces, logs or events for outliers. fn runs on the request's
+// goroutine before the response is written, so it should be fast.
+func WithSlowRequestCallback(threshold time.Duration, fn SlowRequestFunc) Option {
+	return func(p *Prometheus) {
+		p.slowHooks = append(p.slowHooks, slowHook{threshold: threshold, fn: fn})
+	}
+}
+
+// notifySlow calls the slow request hooks whose threshold dur exceeds
+func (p *Prometheus) notifySlow(ctx *fasthttp.RequestCtx, ep string, dur time.Duration) {
+	for _, hook := range p.slowHooks {
+		if dur > hook.threshold {
+			hook.fn(ctx, ep, dur)
+		}
+	}
+}
+
+// WithSlowRequestLogger logs every recorded request slower than threshold with log, which
+// takes a message and alternating keys and values, so the method values of f.e
+// slog.Logger's Warn and zap.SugaredLogger's Warnw can be passed. The method, route
+// pattern, status, duration and remote_ip of the request are logged.
+//
+//	fasthttpprom.WithSlowRequestLogger(time.Second, slog.Default().Warn)
+func WithSlowRequestLogger(threshold time.Duration, log func(msg string, keysAndValues ...interface{})) Option {
+	return func(p *Prometheus) {
+		WithSlowRequestCallback(threshold, func(ctx *fasthttp.RequestCtx, route string, dur time.Duration) {
+			method := p.methodLabel(string(ctx.Method()))
+			log("slow request",
+				"method", method,
+				"route", Observation{Method: method, Path: route}.Route(),
+				"status", ctx.Response.StatusCode(),
+				"duration", dur,
+				"remote_ip", ctx.RemoteIP().String(),
+			)
+		})(p)
+	}
+}
@@ -0,0 +1,108 @@
+package fasthttpprom
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+var defaultSlowestPath = "/slowest"
+
+// WithTopSlowest tracks the n routes with the highest p99 latency over the last window,
+// served as JSON on /slowest of the instrumented router and exported at scrape time in
+// slowest_routes_p99_seconds by rank and path, so on-call can tell what got slow
+// without PromQL
+func WithTopSlowest(n int, window time.Duration) Option {
+	return func(p *Prometheus) {
+		p.slowest = &topSlowest{n: n, stats: newWindowStats(window)}
+	}
+}
+
+// WithSlowestPath serves the slowest routes of WithTopSlowest on path instead of
+// /slowest. An empty path serves them nowhere, f.e to mount SlowestHandler on a route
+// of the application.
+func WithSlowestPath(path string) Option {
+	return func(p *Prometheus) {
+		p.slowestPath = path
+	}
+}
+
+// topSlowest ranks the routes of a sliding window by p99 latency
+type topSlowest struct {
+	n     int
+	stats *windowStats
+	desc  *prometheus.Desc
+}
+
+func (p *Prometheus) registerTopSlowest(subsystem string) {
+	p.slowest.desc = prometheus.NewDesc(
+		prometheus.BuildFQName("", subsystem, "slowest_routes_p99_seconds"),
+		"p99 latencies of the slowest routes over the tracked window by rank",
+		[]string{"rank", "path"}, nil,
+	)
+	prometheus.Register(p.slowest)
+}
+
+// top returns the stats of the n slowest routes at now, slowest first
+func (t *topSlowest) top(now time.Time) []RouteStats {
+	stats := t.stats.snapshot(now)
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].P99 > stats[j].P99 })
+	if len(stats) > t.n {
+		stats = stats[:t.n]
+	}
+
+	return stats
+}
+
+// Describe implements prometheus.Collector
+func (t *topSlowest) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.desc
+}
+
+// Collect implements prometheus.Collector
+func (t *topSlowest) Collect(ch chan<- prometheus.Metric) {
+	for i, rs := range t.top(time.Now()) {
+		ch <- prometheus.MustNewConstMetric(t.desc, prometheus.GaugeValue, rs.P99.Seconds(), strconv.Itoa(i+1), rs.Path)
+	}
+}
+
+// SlowestHandler serves the slowest routes as JSON, or 404 Not Found without
+// WithTopSlowest
+func (p *Prometheus) SlowestHandler() fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if p.slowest == nil {
+			ctx.Error("slowest routes not tracked", fasthttp.StatusNotFound)
+			return
+		}
+		top := p.slowest.top(time.Now())
+		routes := make([]slowRoute, 0, len(top))
+		for _, rs := range top {
+			routes = append(routes, slowRoute{
+				Path:      rs.Path,
+				Requests:  rs.Requests,
+				RPS:       rs.RPS,
+				ErrorRate: rs.ErrorRate,
+				P50:       rs.P50.Seconds(),
+				P99:       rs.P99.Seconds(),
+			})
+		}
+		ctx.SetContentType("application/json")
+		if err := json.NewEncoder(ctx).Encode(routes); err != nil {
+			ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		}
+	}
+}
+
+// slowRoute is the JSON form of the RouteStats of a slow route, with latencies in seconds
+type slowRoute struct {
+	Path      string  `json:"path"`
+	Requests  int64   `json:"requests"`
+	RPS       float64 `json:"rps"`
+	ErrorRate float64 `json:"error_rate"`
+	P50       float64 `json:"p50_seconds"`
+	P99       float64 `json:"p99_seconds"`
+}
@@ -0,0 +1,72 @@
+package fasthttpprom
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+func TestSlowestPath(t *testing.T) {
+	for name, tc := range map[string]struct {
+		opts []Option
+		// path the slowest routes are served on, if any
+		path string
+	}{
+		"default": {path: defaultSlowestPath},
+		"custom":  {opts: []Option{WithSlowestPath("/debug/slowest")}, path: "/debug/slowest"},
+		"none":    {opts: []Option{WithSlowestPath("")}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := router.New()
+			r.GET("/users/{id}", func(ctx *fasthttp.RequestCtx) {})
+			rec := &recorder{}
+			opts := append([]Option{WithTopSlowest(5, time.Minute), WithBackend(rec)}, tc.opts...)
+			p := newTestPrometheus(t, "test_slowest_path_"+name, r, opts...)
+
+			serve(p.Handler, fasthttp.MethodGet, "/users/1")
+			if tc.path != "" {
+				ctx := serve(p.Handler, fasthttp.MethodGet, tc.path)
+				if ctx.Response.StatusCode() != fasthttp.StatusOK || string(ctx.Response.Header.ContentType()) != "application/json" {
+					t.Fatalf("GET %s = %d %s", tc.path, ctx.Response.StatusCode(), ctx.Response.Body())
+				}
+			}
+			if ctx := serve(p.Handler, fasthttp.MethodGet, defaultSlowestPath); tc.path != defaultSlowestPath && ctx.Response.StatusCode() != fasthttp.StatusNotFound {
+				t.Errorf("GET %s = %d, want 404", defaultSlowestPath, ctx.Response.StatusCode())
+			}
+			// requests to the endpoint are not instrumented
+			rec.mu.Lock()
+			defer rec.mu.Unlock()
+			for _, o := range rec.observations {
+				if tc.path != "" && o.Path == "GET_"+tc.path {
+					t.Errorf("request to %s recorded", tc.path)
+				}
+			}
+		})
+	}
+}
+
+func TestEndpointLeavesApplicationRoute(t *testing.T) {
+	r := router.New()
+	r.GET(defaultSlowestPath, func(ctx *fasthttp.RequestCtx) { ctx.SetBodyString("app") })
+	rec := &recorder{}
+	p := newTestPrometheus(t, "test_endpoint_application_route", r, WithTopSlowest(5, time.Minute), WithBackend(rec))
+
+	ctx := serve(p.Handler, fasthttp.MethodGet, defaultSlowestPath)
+	if body := string(ctx.Response.Body()); body != "app" {
+		t.Errorf("GET %s answered %q, want the application route", defaultSlowestPath, body)
+	}
+	if o := rec.last(t); o.Path != "GET_"+defaultSlowestPath {
+		t.Errorf("application route recorded as %q", o.Path)
+	}
+}
+
+func TestSlowestHandler(t *testing.T) {
+	p := NewPrometheus("test_slowest_handler")
+	defer p.Close()
+	ctx := serve(p.SlowestHandler(), fasthttp.MethodGet, "/")
+	if ctx.Response.StatusCode() != fasthttp.StatusNotFound {
+		t.Errorf("SlowestHandler without WithTopSlowest = %d, want 404", ctx.Response.StatusCode())
+	}
+}
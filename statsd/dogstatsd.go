@@ -0,0 +1,75 @@
+package statsd
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	fasthttpprom "github.com/carousell/fasthttp-prometheus-middleware"
+)
+
+// entityIDTag carries the DD_ENTITY_ID of the pod, which the Datadog agent uses for
+// origin detection on Kubernetes
+const entityIDTag = "dd.internal.entity_id:"
+
+// NewDogStatsD creates a backend emitting, for every request, a distribution (or histogram
+// with cfg.Histogram) <prefix>request_duration in milliseconds and a counter
+// <prefix>requests, both tagged with method, path and code. On Kubernetes, expose the pod
+// UID as DD_ENTITY_ID through the downward API to enable origin detection.
+func NewDogStatsD(cfg Config) (*Backend, error) {
+	tags := append([]string(nil), cfg.Tags...)
+	if id := os.Getenv("DD_ENTITY_ID"); id != "" {
+		tags = append(tags, entityIDTag+id)
+	}
+	constTags := strings.Join(tags, ",")
+	durationType := "|d|#"
+	if cfg.Histogram {
+		durationType = "|h|#"
+	}
+
+	return newBackend(cfg, func(buf []byte, prefix string, o fasthttpprom.Observation) []byte {
+		buf = append(buf, prefix...)
+		buf = append(buf, "request_duration:"...)
+		buf = strconv.AppendFloat(buf, float64(o.Duration)/float64(time.Millisecond), 'f', -1, 64)
+		buf = append(buf, durationType...)
+		buf = appendTags(buf, constTags, o)
+		buf = append(buf, '\n')
+		buf = append(buf, prefix...)
+		buf = append(buf, "requests:1|c|#"...)
+		buf = appendTags(buf, constTags, o)
+		buf = append(buf, '\n')
+
+		return buf
+	})
+}
+
+func appendTags(buf []byte, constTags string, o fasthttpprom.Observation) []byte {
+	buf = append(buf, "method:"...)
+	buf = appendTagValue(buf, o.Method)
+	buf = append(buf, ",path:"...)
+	buf = appendTagValue(buf, o.Route())
+	buf = append(buf, ",code:"...)
+	buf = appendTagValue(buf, o.Code)
+	if constTags != "" {
+		buf = append(buf, ',')
+		buf = append(buf, constTags...)
+	}
+
+	return buf
+}
+
+// appendTagValue appends s with the characters which separate DogStatsD tags and fields
+// replaced by '_'
+func appendTagValue(buf []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ',', '|', '#', ' ', '\n':
+			buf = append(buf, '_')
+		default:
+			buf = append(buf, c)
+		}
+	}
+
+	return buf
+}
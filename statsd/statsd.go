@@ -0,0 +1,194 @@
+// Package statsd emits the middleware's request metrics to a StatsD or DogStatsD daemon,
+// for setups running Graphite/StatsD or Datadog alongside Prometheus.
+//
+//	backend, err := statsd.New(statsd.Config{Addr: "127.0.0.1:8125", Prefix: "api."})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer backend.Close()
+//	p := fasthttpprom.NewPrometheus("", fasthttpprom.WithBackend(backend))
+package statsd
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	fasthttpprom "github.com/carousell/fasthttp-prometheus-middleware"
+)
+
+var (
+	defaultFlushInterval = time.Second
+	// defaultMaxPacketSize keeps datagrams below the usual Ethernet MTU
+	defaultMaxPacketSize = 1432
+)
+
+// Config configures a StatsD backend
+type Config struct {
+	// Addr is the host:port of the StatsD daemon
+	Addr string
+	// Prefix is prepended to every metric name, f.e "api."
+	Prefix string
+	// FlushInterval is the longest time a metric is buffered, 1s if zero
+	FlushInterval time.Duration
+	// MaxPacketSize is the largest datagram sent, 1432 bytes if zero
+	MaxPacketSize int
+	// Tags are added to every metric by DogStatsD backends, f.e "env:prod"
+	Tags []string
+	// Histogram makes DogStatsD backends send durations as histograms rather than
+	// distributions
+	Histogram bool
+}
+
+// Backend buffers request metrics and sends them over UDP
+type Backend struct {
+	cfg    Config
+	format func(buf []byte, prefix string, o fasthttpprom.Observation) []byte
+
+	mu   sync.Mutex
+	conn net.Conn
+	buf  bytes.Buffer
+	line []byte
+	// buffered is the number of observations in buf
+	buffered int
+	onDrop   atomic.Pointer[func(n int)]
+
+	done     chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// New creates a backend emitting, for every request, a timing
+// <prefix>request_duration.<path>.<code> in milliseconds and a counter
+// <prefix>requests.<path>.<code>, where path is the path label with characters StatsD
+// treats specially replaced by '_'
+func New(cfg Config) (*Backend, error) {
+	return newBackend(cfg, appendStatsD)
+}
+
+func newBackend(cfg Config, format func([]byte, string, fasthttpprom.Observation) []byte) (*Backend, error) {
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	if cfg.MaxPacketSize <= 0 {
+		cfg.MaxPacketSize = defaultMaxPacketSize
+	}
+	conn, err := net.Dial("udp", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	b := &Backend{
+		cfg:    cfg,
+		format: format,
+		conn:   conn,
+		done:   make(chan struct{}),
+	}
+	b.wg.Add(1)
+	go b.run()
+
+	return b, nil
+}
+
+// Record implements fasthttpprom.MetricsBackend
+func (b *Backend) Record(o fasthttpprom.Observation) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.line = b.format(b.line[:0], b.cfg.Prefix, o)
+	if b.buf.Len() > 0 && b.buf.Len()+len(b.line) > b.cfg.MaxPacketSize {
+		b.flushLocked()
+	}
+	b.buf.Write(b.line)
+	b.buffered++
+}
+
+// SetDropHandler implements fasthttpprom.DropReporter, fn is called with the number of
+// observations lost by failed sends
+func (b *Backend) SetDropHandler(fn func(n int)) {
+	b.onDrop.Store(&fn)
+}
+
+// Flush sends the buffered metrics
+func (b *Backend) Flush() {
+	b.mu.Lock()
+	b.flushLocked()
+	b.mu.Unlock()
+}
+
+// Close flushes the buffered metrics and closes the connection
+func (b *Backend) Close() error {
+	b.stopOnce.Do(func() { close(b.done) })
+	b.wg.Wait()
+	b.Flush()
+
+	return b.conn.Close()
+}
+
+func (b *Backend) run() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.Flush()
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *Backend) flushLocked() {
+	if b.buf.Len() == 0 {
+		return
+	}
+	// lines are newline terminated, the last one is not needed in a datagram
+	if _, err := b.conn.Write(bytes.TrimSuffix(b.buf.Bytes(), []byte{'\n'})); err != nil {
+		if fn := b.onDrop.Load(); fn != nil {
+			(*fn)(b.buffered)
+		}
+	}
+	b.buf.Reset()
+	b.buffered = 0
+}
+
+func appendStatsD(buf []byte, prefix string, o fasthttpprom.Observation) []byte {
+	buf = appendName(buf, prefix, "request_duration", o)
+	buf = append(buf, ':')
+	buf = strconv.AppendFloat(buf, float64(o.Duration)/float64(time.Millisecond), 'f', -1, 64)
+	buf = append(buf, "|ms\n"...)
+	buf = appendName(buf, prefix, "requests", o)
+	buf = append(buf, ":1|c\n"...)
+
+	return buf
+}
+
+func appendName(buf []byte, prefix, name string, o fasthttpprom.Observation) []byte {
+	buf = append(buf, prefix...)
+	buf = append(buf, name...)
+	buf = append(buf, '.')
+	buf = appendSanitized(buf, o.Path)
+	buf = append(buf, '.')
+	buf = appendSanitized(buf, o.Code)
+
+	return buf
+}
+
+// appendSanitized appends s with the characters which separate StatsD name segments,
+// values and types replaced by '_'
+func appendSanitized(buf []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '.', ':', '|', '@', '#', ',', '/', ' ', '\n':
+			buf = append(buf, '_')
+		default:
+			buf = append(buf, c)
+		}
+	}
+
+	return buf
+}
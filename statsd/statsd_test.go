@@ -0,0 +1,93 @@
+package statsd
+
+import (
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	fasthttpprom "github.com/carousell/fasthttp-prometheus-middleware"
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+// serveRequest records a GET /users/1 request through the middleware with backend
+func serveRequest(t *testing.T, subsystem string, backend fasthttpprom.MetricsBackend) {
+	t.Helper()
+	r := router.New()
+	r.GET("/users/{id}", func(ctx *fasthttp.RequestCtx) {})
+	p := fasthttpprom.NewPrometheus(subsystem, fasthttpprom.WithOnlyBackend(backend))
+	defer p.Close()
+	if err := p.Use(r); err != nil {
+		t.Fatal(err)
+	}
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/users/1")
+	p.Handler(ctx)
+}
+
+// readLines returns the sorted metric lines of the next datagram received on conn
+func readLines(t *testing.T, conn net.PacketConn) []string {
+	t.Helper()
+	buf := make([]byte, defaultMaxPacketSize)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(buf[:n]), "\n")
+	sort.Strings(lines)
+
+	return lines
+}
+
+func TestBackend(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		new  func(Config) (*Backend, error)
+		want []string
+	}{
+		{
+			name: "statsd",
+			new:  New,
+			want: []string{`^api\.request_duration\.GET__users_\{id\}\.200:[0-9.]+\|ms$`, `^api\.requests\.GET__users_\{id\}\.200:1\|c$`},
+		},
+		{
+			name: "dogstatsd",
+			new:  NewDogStatsD,
+			want: []string{
+				`^api\.request_duration:[0-9.]+\|d\|#method:GET,path:/users/\{id\},code:200,env:test$`,
+				`^api\.requests:1\|c\|#method:GET,path:/users/\{id\},code:200,env:test$`,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			b, err := tc.new(Config{Addr: conn.LocalAddr().String(), Prefix: "api.", Tags: []string{"env:test"}, FlushInterval: time.Hour})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			serveRequest(t, "test_statsd_"+tc.name, b)
+			if err := b.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			lines := readLines(t, conn)
+			if len(lines) != len(tc.want) {
+				t.Fatalf("sent %q, want %d lines", lines, len(tc.want))
+			}
+			for i, want := range tc.want {
+				if !regexp.MustCompile(want).MatchString(lines[i]) {
+					t.Errorf("line %q, want %q", lines[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package fasthttpprom
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+var defaultStatuszPath = "/statusz"
+
+var statuszTemplate = template.Must(template.New("statusz").Funcs(template.FuncMap{
+	"percent": func(f float64) float64 { return f * 100 },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><title>statusz</title></head>
+<body>
+<h1>Requests over the last {{.Window}}</h1>
+<table border="1" cellpadding="4">
+<tr><th>path</th><th>requests</th><th>QPS</th><th>p50</th><th>p99</th><th>error rate</th></tr>
+{{range .Routes}}<tr><td>{{.Path}}</td><td>{{.Requests}}</td><td>{{printf "%.2f" .RPS}}</td><td>{{.P50}}</td><td>{{.P99}}</td><td>{{printf "%.2f%%" (percent .ErrorRate)}}</td></tr>
+{{end}}</table>
+<p>generated {{.Now.Format "2006-01-02T15:04:05Z07:00"}}</p>
+</body>
+</html>
+`))
+
+// WithStatusz serves a /statusz HTML page on the instrumented router, showing the QPS,
+// p50/p99 latency and 5xx error rate of every route over the last window, for a quick
+// glance without Grafana
+func WithStatusz(window time.Duration) Option {
+	return func(p *Prometheus) {
+		p.statuszWindow = window
+	}
+}
+
+func (p *Prometheus) statuszHandler() fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		now := time.Now()
+		var buf bytes.Buffer
+		err := statuszTemplate.Execute(&buf, struct {
+			Window time.Duration
+			Now    time.Time
+			Routes []RouteStats
+		}{
+			Window: time.Duration(p.window.slots) * time.Second,
+			Now:    now,
+			Routes: p.window.snapshot(now),
+		})
+		if err != nil {
+			log.Printf("Fail to render statusz: %s\n", err)
+			ctx.Error(fasthttp.StatusMessage(fasthttp.StatusInternalServerError), fasthttp.StatusInternalServerError)
+			return
+		}
+		ctx.SetContentType("text/html; charset=utf-8")
+		ctx.SetBody(buf.Bytes())
+	}
+}
@@ -0,0 +1,53 @@
+package fasthttpprom
+
+import (
+	"bufio"
+
+	"github.com/valyala/fasthttp"
+)
+
+// SetBodyStreamWriter calls ctx.SetBodyStreamWriter, recording the duration of the stream
+// in stream_duration_seconds and its size in stream_bytes_total by path. The request
+// duration only covers the handler, so use it for long lived streams such as Server-Sent
+// Events to keep them out of request_duration_seconds.
+func (p *Prometheus) SetBodyStreamWriter(ctx *fasthttp.RequestCtx, sw fasthttp.StreamWriter) {
+	ep := p.requestLabel(ctx, "")
+	// failed writes on connections accepted by a Listener are counted by trackDisconnect
+	tracked := listenerConnOf(ctx.Conn()) != nil
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		start := p.clock.Now()
+		cw := &streamWriter{w: w}
+		bw := bufio.NewWriter(cw)
+		sw(bw)
+		bw.Flush()
+		if ep == "" {
+			return
+		}
+		if cw.err != nil && !tracked && p.disconnectMetrics {
+			p.clientDisconnects.WithLabelValues(ep).Inc()
+		}
+		p.streamDur.WithLabelValues(ep).Observe(p.clock.Now().Sub(start).Seconds())
+		p.streamBytes.WithLabelValues(ep).Add(float64(cw.n))
+	})
+}
+
+// streamWriter counts the bytes written to w. Writes are flushed right away, so flushing
+// the writer handed to the stream writer still sends the data to the client.
+type streamWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (sw *streamWriter) Write(b []byte) (int, error) {
+	n, err := sw.w.Write(b)
+	sw.n += int64(n)
+	if err == nil {
+		err = sw.w.Flush()
+	}
+	if err != nil && sw.err == nil {
+		sw.err = err
+	}
+
+	return n, err
+}
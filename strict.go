@@ -0,0 +1,89 @@
+package fasthttpprom
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/fasthttp/router"
+)
+
+// strictCodesPerRoute is the number of status codes assumed per route when estimating
+// the number of series
+const strictCodesPerRoute = 10
+
+// strictMaxSeries is the estimated number of series above which the configuration is
+// a cardinality risk unless WithMaxSeries caps it
+const strictMaxSeries = 10000
+
+// WithStrictMode logs every configuration which is likely to produce unbounded label
+// cardinality, as reported by Validate, whenever the route snapshot is taken
+func WithStrictMode() Option {
+	return func(p *Prometheus) {
+		p.strict = true
+	}
+}
+
+// Validate scans the registered routes and the configured labels for settings which are
+// likely to produce unbounded label cardinality. Call it once the routes are registered,
+// f.e to refuse to start.
+func (p *Prometheus) Validate() error {
+	risks := p.cardinalityRisks(p.registeredRoutes())
+	if len(risks) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("fasthttpprom: cardinality risks: %s", strings.Join(risks, "; "))
+}
+
+// cardinalityRisks describes the settings likely to produce unbounded label cardinality
+// with routes registered
+func (p *Prometheus) cardinalityRisks(routes map[string][]string) []string {
+	var risks []string
+	rawPaths := p.fallback == FallbackPath && p.maxPaths == 0
+	if rawPaths && p.normalizer != nil {
+		risks = append(risks, "requests matching no route are labeled with their normalized path without WithMaxPathLabels")
+	}
+
+	methods := make([]string, 0, len(routes))
+	for method := range routes {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	count := 0
+	for _, method := range methods {
+		for _, pattern := range routes[method] {
+			count++
+			if rawPaths && strings.Contains(pattern, ":*}") {
+				label := method
+				if label == router.MethodWild {
+					label = "ANY"
+				}
+				risks = append(risks, fmt.Sprintf("catch-all route %s is labeled with the raw path when its pattern cannot be resolved, without WithMaxPathLabels", routeLabel(label, pattern)))
+			}
+		}
+	}
+
+	if p.maxSeries == 0 {
+		series := (count + 1) * strictCodesPerRoute
+		for _, source := range p.labelSources {
+			series *= source.values
+		}
+		if series > strictMaxSeries {
+			risks = append(risks, fmt.Sprintf("up to %d series of request_duration_seconds without WithMaxSeries", series))
+		}
+	}
+
+	return risks
+}
+
+// logCardinalityRisks logs the cardinality risks of routes in strict mode
+func (p *Prometheus) logCardinalityRisks(routes map[string][]string) {
+	if !p.strict {
+		return
+	}
+	for _, risk := range p.cardinalityRisks(routes) {
+		log.Printf("WARNING cardinality risk: %s\n", risk)
+	}
+}
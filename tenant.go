@@ -0,0 +1,152 @@
+package fasthttpprom
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+)
+
+// defaultMaxTenants caps the number of tenant registries
+const defaultMaxTenants = 100
+
+// TenantConfig configures per tenant registries for multi-tenant gateways
+type TenantConfig struct {
+	// Resolve returns the tenant of a request, or an empty string for requests which are
+	// recorded in request_duration_seconds of the default registry
+	Resolve func(ctx *fasthttp.RequestCtx) string
+	// MaxTenants caps the number of tenant registries, the requests of further tenants
+	// are recorded in the default registry. 100 if zero.
+	MaxTenants int
+}
+
+// WithTenants records the requests of every tenant resolved by cfg.Resolve in
+// request_duration_seconds of a registry of its own, served on MetricsPath/{tenant} by
+// both Use and Custom, so the series of tenants are isolated and their scrapes can be
+// authorized separately. Tenants are recorded with WithOnlyBackend too.
+func WithTenants(cfg TenantConfig) Option {
+	return func(p *Prometheus) {
+		if cfg.MaxTenants <= 0 {
+			cfg.MaxTenants = defaultMaxTenants
+		}
+		p.tenants = &tenants{cfg: cfg, byName: make(map[string]*tenant)}
+	}
+}
+
+// tenants holds the registries of the tenants seen so far
+type tenants struct {
+	cfg    TenantConfig
+	mu     sync.RWMutex
+	byName map[string]*tenant
+}
+
+// tenant is the registry of a tenant and its histogram
+type tenant struct {
+	registry *prometheus.Registry
+	reqDur   *prometheus.HistogramVec
+	handler  fasthttp.RequestHandler
+}
+
+// get returns the registry of name, creating it with the labels of p if create is set
+// and there is room left under the cap
+func (t *tenants) get(p *Prometheus, name string, create bool) *tenant {
+	t.mu.RLock()
+	tn := t.byName[name]
+	t.mu.RUnlock()
+	if tn != nil || !create {
+		return tn
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tn := t.byName[name]; tn != nil {
+		return tn
+	}
+	if len(t.byName) >= t.cfg.MaxTenants {
+		return nil
+	}
+	tn = &tenant{
+		registry: prometheus.NewRegistry(),
+		reqDur: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Subsystem: p.subsystem,
+				Name:      "request_duration_seconds",
+				Help:      "request latencies",
+				Buckets:   p.buckets,
+			},
+			p.labelNames(),
+		),
+	}
+	tn.registry.MustRegister(tn.reqDur)
+	tn.handler = fasthttpadaptor.NewFastHTTPHandler(promhttp.HandlerFor(tn.registry, promhttp.HandlerOpts{}))
+	t.byName[name] = tn
+
+	return tn
+}
+
+// tenantOf resolves the tenant of ctx, if tenants are configured
+func (p *Prometheus) tenantOf(ctx *fasthttp.RequestCtx) string {
+	if p.tenants == nil {
+		return ""
+	}
+
+	return p.tenants.cfg.Resolve(ctx)
+}
+
+// tenantHandler serves the metrics of the tenant in the path
+func (p *Prometheus) tenantHandler() fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		name, _ := ctx.UserValue("tenant").(string)
+		tn := p.tenants.get(p, name, false)
+		if tn == nil {
+			ctx.Error(fasthttp.StatusMessage(fasthttp.StatusNotFound), fasthttp.StatusNotFound)
+			return
+		}
+		tn.handler(ctx)
+	}
+}
+
+// isTenantMetricsPath reports whether uri is the metrics path of a tenant
+func (p *Prometheus) isTenantMetricsPath(uri string) bool {
+	return p.tenants != nil && strings.HasPrefix(uri, p.metricsPath+"/") && len(uri) > len(p.metricsPath)+1
+}
+
+// tenantBackend records the observations of tenants in their registries. It runs before
+// the default backend, which leaves the observations of tenants with a registry to it.
+type tenantBackend struct {
+	p *Prometheus
+}
+
+func (b tenantBackend) Record(o Observation) {
+	if o.Tenant == "" {
+		return
+	}
+	tn := b.p.tenants.get(b.p, o.Tenant, true)
+	if tn == nil {
+		return
+	}
+	values := []string{o.Code, o.Path}
+	for _, source := range b.p.labelSources {
+		values = append(values, o.Labels[source.name])
+	}
+	ob, err := tn.reqDur.GetMetricWithLabelValues(values...)
+	if err != nil {
+		b.p.instrumentationError(reasonLabelValues, err)
+		return
+	}
+	ob.Observe(o.Duration.Seconds())
+}
+
+// recorded reports whether o was recorded in the registry of its tenant
+func (t *tenants) recorded(o Observation) bool {
+	if o.Tenant == "" {
+		return false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.byName[o.Tenant] != nil
+}
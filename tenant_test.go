@@ -0,0 +1,60 @@
+package fasthttpprom
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+// tenantHeader resolves the tenant of a request from the X-Tenant header
+func tenantHeader(ctx *fasthttp.RequestCtx) string {
+	return string(ctx.Request.Header.Peek("X-Tenant"))
+}
+
+func TestTenants(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		custom bool
+		opts   []Option
+	}{
+		{name: "use"},
+		{name: "custom", custom: true},
+		{name: "only_backend", opts: []Option{WithOnlyBackend(&recorder{})}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := router.New()
+			r.GET("/a", func(ctx *fasthttp.RequestCtx) {})
+			subsystem := "test_tenants_" + tc.name
+			p := NewPrometheus(subsystem, append(tc.opts, WithTenants(TenantConfig{Resolve: tenantHeader}))...)
+			defer p.Close()
+			install := p.Use
+			if tc.custom {
+				install = p.Custom
+			}
+			if err := install(r); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := &fasthttp.RequestCtx{}
+			ctx.Request.SetRequestURI("/a")
+			ctx.Request.Header.Set("X-Tenant", "acme")
+			p.Handler(ctx)
+
+			ctx = serve(p.Handler, fasthttp.MethodGet, "/metrics/acme")
+			if code := ctx.Response.StatusCode(); code != fasthttp.StatusOK {
+				t.Fatalf("tenant metrics answered %d", code)
+			}
+			if body := string(ctx.Response.Body()); !strings.Contains(body, subsystem+`_request_duration_seconds_count{code="200",path="GET_/a"} 1`) {
+				t.Errorf("tenant request not recorded:\n%s", body)
+			}
+			if got, _ := metricValue(t, subsystem+"_request_duration_seconds", map[string]string{"path": "GET_/a"}); got != 0 {
+				t.Errorf("tenant request recorded in the default registry")
+			}
+			if ctx := serve(p.Handler, fasthttp.MethodGet, "/metrics/unknown"); ctx.Response.StatusCode() != fasthttp.StatusNotFound {
+				t.Errorf("unknown tenant answered %d", ctx.Response.StatusCode())
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package fasthttpprom
+
+import (
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TextfileConfig configures writing the metrics to a file read by the node_exporter
+// textfile collector
+type TextfileConfig struct {
+	// Path of the file, which has to end with .prom to be picked up by node_exporter
+	Path string
+	// Interval between writes. No periodic writes are made when it is zero.
+	Interval time.Duration
+	// WriteOnClose makes a final write when Close is called
+	WriteOnClose bool
+	// ErrorHandler is called with every failed write. Errors are logged when it is nil.
+	ErrorHandler func(error)
+}
+
+// WithTextfile writes the metrics in the text exposition format to cfg.Path every
+// cfg.Interval until Close is called, for hosts where opening another port is not
+// allowed. The file is replaced atomically by renaming a temporary file.
+func WithTextfile(cfg TextfileConfig) Option {
+	return func(p *Prometheus) {
+		p.textfile = &cfg
+	}
+}
+
+// WriteTextfile writes the current metrics to the file configured with WithTextfile
+func (p *Prometheus) WriteTextfile() error {
+	if p.textfile == nil {
+		return nil
+	}
+
+	return prometheus.WriteToTextfile(p.textfile.Path, prometheus.DefaultGatherer)
+}
+
+// startTextfile schedules the periodic writes and the configured final write
+func (p *Prometheus) startTextfile() {
+	write := func() { p.textfileError(p.WriteTextfile()) }
+	var final func()
+	if p.textfile.WriteOnClose {
+		final = write
+	}
+	p.runEvery(p.textfile.Interval, 0, write, final)
+}
+
+func (p *Prometheus) textfileError(err error) {
+	if err == nil {
+		return
+	}
+	if p.textfile.ErrorHandler != nil {
+		p.textfile.ErrorHandler(err)
+		return
+	}
+	log.Printf("Fail to write metrics textfile: %s\n", err)
+}
@@ -0,0 +1,154 @@
+package fasthttpprom
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// tlsListener serves TLS on the accepted connections, recording their handshakes
+type tlsListener struct {
+	net.Listener
+	config   *tls.Config
+	name     string
+	duration prometheus.Observer
+	failures *prometheus.CounterVec
+	versions *prometheus.CounterVec
+}
+
+// NewTLSListener wraps ln like tls.NewListener, registering tls_handshake_duration_seconds,
+// tls_handshake_failures_total by reason and tls_handshakes_total by negotiated version
+// and cipher under subsystem, all labeled with listener=name. Wrap a Listener to record
+// the connections as well.
+func NewTLSListener(ln net.Listener, config *tls.Config, subsystem, name string) net.Listener {
+	duration := registerCollector(prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: subsystem,
+			Name:      "tls_handshake_duration_seconds",
+			Help:      "TLS handshake latencies",
+			Buckets:   DefaultBuckets,
+		},
+		[]string{"listener"},
+	)).(*prometheus.HistogramVec)
+	failures := registerCollector(prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: subsystem,
+			Name:      "tls_handshake_failures_total",
+			Help:      "failed TLS handshakes by reason",
+		},
+		[]string{"listener", "reason"},
+	)).(*prometheus.CounterVec)
+	versions := registerCollector(prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: subsystem,
+			Name:      "tls_handshakes_total",
+			Help:      "completed TLS handshakes by negotiated version and cipher suite",
+		},
+		[]string{"listener", "version", "cipher"},
+	)).(*prometheus.CounterVec)
+
+	return &tlsListener{
+		Listener: ln,
+		config:   config,
+		name:     name,
+		duration: duration.WithLabelValues(name),
+		failures: failures,
+		versions: versions,
+	}
+}
+
+func (l *tlsListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return &tlsConn{Conn: tls.Server(c, l.config), l: l}, nil
+}
+
+// tlsConn times the handshake, which happens on the first read or write rather than in
+// Accept so slow clients don't block the accept loop
+type tlsConn struct {
+	*tls.Conn
+	l             *tlsListener
+	handshakeOnce sync.Once
+	handshakeErr  error
+}
+
+func (c *tlsConn) Handshake() error {
+	c.handshakeOnce.Do(func() {
+		start := time.Now()
+		c.handshakeErr = c.Conn.Handshake()
+		c.l.duration.Observe(time.Since(start).Seconds())
+		if c.handshakeErr != nil {
+			c.l.failures.WithLabelValues(c.l.name, tlsFailureReason(c.handshakeErr)).Inc()
+			return
+		}
+		state := c.Conn.ConnectionState()
+		c.l.versions.WithLabelValues(c.l.name, tlsVersionName(state.Version), tls.CipherSuiteName(state.CipherSuite)).Inc()
+	})
+
+	return c.handshakeErr
+}
+
+func (c *tlsConn) Read(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+
+	return c.Conn.Read(b)
+}
+
+func (c *tlsConn) Write(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+
+	return c.Conn.Write(b)
+}
+
+// tlsFailureReason classifies a failed handshake into a low cardinality reason label
+func tlsFailureReason(err error) string {
+	var netErr net.Error
+	var headerErr tls.RecordHeaderError
+	msg := err.Error()
+	switch {
+	case errors.Is(err, io.EOF):
+		return "eof"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &headerErr):
+		return "not_tls"
+	case strings.Contains(msg, "protocol version"):
+		return "protocol_version"
+	case strings.Contains(msg, "cipher suite"):
+		return "cipher"
+	case strings.Contains(msg, "certificate"):
+		return "certificate"
+	case strings.Contains(msg, "connection reset"):
+		return "reset"
+	}
+
+	return "other"
+}
+
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+
+	return "unknown"
+}
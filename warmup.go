@@ -0,0 +1,56 @@
+package fasthttpprom
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// WarmupMode selects how requests served during the warm-up period are recorded
+type WarmupMode int
+
+const (
+	// WarmupSkip does not record requests started during the warm-up period
+	WarmupSkip WarmupMode = iota
+	// WarmupLabel records every request with a warmup label, "true" for requests started
+	// during the warm-up period, so alerts can exclude them
+	WarmupLabel
+)
+
+// WithWarmup treats the requests started within period after NewPrometheus according to
+// mode, so cache filling and connection pool establishment after a deploy don't trigger
+// latency alerts
+func WithWarmup(period time.Duration, mode WarmupMode) Option {
+	return func(p *Prometheus) {
+		p.warmup = period
+		p.warmupMode = mode
+		if mode == WarmupLabel {
+			p.labelSources = append(p.labelSources, labelSource{
+				name: warmupLabel,
+				// replaced by labelWarmup with the start of the request once known
+				extract: func(ctx *fasthttp.RequestCtx) string {
+					return strconv.FormatBool(p.inWarmup(p.clock.Now()))
+				},
+				values: 2,
+			})
+		}
+	}
+}
+
+// warmupLabel is the name of the label of WarmupLabel
+const warmupLabel = "warmup"
+
+// inWarmup reports whether a request started at start, measured with p.clock like the
+// end of the warm-up period, is within the warm-up period
+func (p *Prometheus) inWarmup(start time.Time) bool {
+	return p.warmup > 0 && start.Before(p.warmupUntil)
+}
+
+// labelWarmup sets the warmup label of o from the start of the request with WarmupLabel,
+// so both modes agree on the requests of the warm-up period
+func (p *Prometheus) labelWarmup(o *Observation) {
+	if p.warmupMode == WarmupLabel && p.warmup > 0 {
+		o.Labels[warmupLabel] = strconv.FormatBool(p.inWarmup(o.Start))
+	}
+}
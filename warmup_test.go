@@ -0,0 +1,40 @@
+package fasthttpprom
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+func TestWarmupModes(t *testing.T) {
+	const period = 50 * time.Millisecond
+	r := router.New()
+	r.GET("/users", func(ctx *fasthttp.RequestCtx) {})
+	labeled, skipped := &recorder{}, &recorder{}
+	label := newTestPrometheus(t, "test_warmup_label", r, WithWarmup(period, WarmupLabel), WithBackend(labeled))
+	skip := NewPrometheus("test_warmup_skip", WithWarmup(period, WarmupSkip), WithBackend(skipped))
+	defer skip.Close()
+	skip.setRouter(r)
+	skipHandler := skip.HandlerFunc()
+
+	serve(label.Handler, fasthttp.MethodGet, "/users")
+	serve(skipHandler, fasthttp.MethodGet, "/users")
+	if o := labeled.last(t); o.Labels[warmupLabel] != "true" {
+		t.Errorf("request during warm-up labeled warmup=%q, want true", o.Labels[warmupLabel])
+	}
+	if len(skipped.observations) != 0 {
+		t.Error("request during warm-up recorded with WarmupSkip")
+	}
+
+	time.Sleep(period)
+	serve(label.Handler, fasthttp.MethodGet, "/users")
+	serve(skipHandler, fasthttp.MethodGet, "/users")
+	if o := labeled.last(t); o.Labels[warmupLabel] != "false" {
+		t.Errorf("request after warm-up labeled warmup=%q, want false", o.Labels[warmupLabel])
+	}
+	if len(skipped.observations) != 1 {
+		t.Error("request after warm-up not recorded with WarmupSkip")
+	}
+}
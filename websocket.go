@@ -0,0 +1,82 @@
+package fasthttpprom
+
+import (
+	"crypto/tls"
+	"net"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+)
+
+// WithWebSocketMetrics counts the requests upgraded to WebSocket in
+// websocket_upgrades_total by path and keeps the connections accepted by a Listener in
+// active_websocket_connections until they close. Upgraded requests are never recorded
+// in request_duration_seconds.
+func WithWebSocketMetrics() Option {
+	return func(p *Prometheus) {
+		p.websocketMetrics = true
+	}
+}
+
+func (p *Prometheus) registerWebSocketMetrics(subsystem string) {
+	p.websocketUpgrades = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: subsystem,
+			Name:      "websocket_upgrades_total",
+			Help:      "connections upgraded to WebSocket",
+		},
+		[]string{"path"},
+	)
+	p.activeWebSockets = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Subsystem: subsystem,
+			Name:      "active_websocket_connections",
+			Help:      "currently open WebSocket connections accepted by an instrumented Listener",
+		},
+	)
+	prometheus.Register(p.websocketUpgrades)
+	prometheus.Register(p.activeWebSockets)
+}
+
+// isWebSocket reports whether the handler upgraded the connection of ctx
+func isWebSocket(ctx *fasthttp.RequestCtx) bool {
+	return ctx.Hijacked() && ctx.Request.Header.ConnectionUpgrade()
+}
+
+// trackWebSocket counts the upgrade of the connection of ctx and keeps it in the active
+// connections gauge until it is closed. Only connections accepted by a Listener are kept
+// in the gauge, since closing others cannot be observed.
+func (p *Prometheus) trackWebSocket(ctx *fasthttp.RequestCtx, ep string) {
+	if !p.websocketMetrics || !p.recording() {
+		return
+	}
+	p.websocketUpgrades.WithLabelValues(ep).Inc()
+	conn := listenerConnOf(ctx.Conn())
+	if conn == nil {
+		return
+	}
+	p.activeWebSockets.Inc()
+	conn.notifyClose(p.activeWebSockets.Dec)
+}
+
+// listenerConnOf returns the connection accepted by a Listener which c is or wraps, if any
+func listenerConnOf(c net.Conn) *listenerConn {
+	for c != nil {
+		switch conn := c.(type) {
+		case *listenerConn:
+			return conn
+		case *countingConn:
+			c = conn.Conn
+		case *rejectionConn:
+			c = conn.Conn
+		case *tlsConn:
+			c = conn.NetConn()
+		case *tls.Conn:
+			c = conn.NetConn()
+		default:
+			return nil
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package fasthttpprom
+
+import (
+	"net"
+	"testing"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+func TestWebSocketMetrics(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"enabled":  {WithWebSocketMetrics()},
+		"disabled": nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := router.New()
+			r.GET("/ws", func(ctx *fasthttp.RequestCtx) {
+				ctx.SetStatusCode(fasthttp.StatusSwitchingProtocols)
+				ctx.Hijack(func(c net.Conn) {})
+			})
+			subsystem := "test_websocket_metrics_" + name
+			p := newTestPrometheus(t, subsystem, r, opts...)
+
+			ctx := &fasthttp.RequestCtx{}
+			ctx.Request.SetRequestURI("/ws")
+			ctx.Request.Header.Set(fasthttp.HeaderConnection, "Upgrade")
+			ctx.Request.Header.Set(fasthttp.HeaderUpgrade, "websocket")
+			p.Handler(ctx)
+
+			upgrades := gatheredLabels(t, subsystem+"_websocket_upgrades_total")
+			if opts == nil && len(upgrades) > 0 {
+				t.Errorf("websocket_upgrades_total exported without WithWebSocketMetrics")
+			}
+			if v, _ := metricValue(t, subsystem+"_websocket_upgrades_total", map[string]string{"path": "GET_/ws"}); opts != nil && v != 1 {
+				t.Errorf("websocket_upgrades_total = %v, want 1", v)
+			}
+			if _, ok := metricValue(t, subsystem+"_request_duration_seconds", map[string]string{"path": "GET_/ws"}); ok {
+				t.Error("upgraded request recorded in request_duration_seconds")
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package fasthttpprom
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// samplesPerSlot bounds the durations kept per route and second for quantile estimation
+const samplesPerSlot = 128
+
+// RouteStats summarizes the requests of one route over a recent window
+type RouteStats struct {
+	Path      string
+	Requests  int64
+	RPS       float64
+	ErrorRate float64
+	P50       time.Duration
+	P90       time.Duration
+	P99       time.Duration
+}
+
+// windowStats keeps per-route request counts and duration samples in one second slots
+// over a sliding window
+type windowStats struct {
+	mu     sync.Mutex
+	slots  int
+	routes map[string][]windowSlot
+}
+
+type windowSlot struct {
+	sec       int64
+	requests  int64
+	errors    int64
+	seen      int64
+	durations []time.Duration
+}
+
+func newWindowStats(window time.Duration) *windowStats {
+	slots := int(window / time.Second)
+	if slots < 1 {
+		slots = 1
+	}
+
+	return &windowStats{
+		slots:  slots,
+		routes: make(map[string][]windowSlot),
+	}
+}
+
+// Record implements MetricsBackend. Requests answered with a 5xx code count as errors.
+func (w *windowStats) Record(o Observation) {
+	sec := o.Start.Unix()
+	isError := len(o.Code) == 3 && o.Code[0] == '5'
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ring, ok := w.routes[o.Path]
+	if !ok {
+		ring = make([]windowSlot, w.slots)
+		w.routes[o.Path] = ring
+	}
+	s := &ring[int(sec%int64(w.slots))]
+	if s.sec != sec {
+		*s = windowSlot{sec: sec, durations: s.durations[:0]}
+	}
+	s.requests++
+	if isError {
+		s.errors++
+	}
+	// reservoir sampling keeps a uniform sample of the second's durations
+	s.seen++
+	if len(s.durations) < samplesPerSlot {
+		s.durations = append(s.durations, o.Duration)
+	} else if i := rand.Int63n(s.seen); i < samplesPerSlot {
+		s.durations[i] = o.Duration
+	}
+}
+
+// snapshot summarizes every route seen within the window ending at now, sorted by path
+func (w *windowStats) snapshot(now time.Time) []RouteStats {
+	oldest := now.Unix() - int64(w.slots) + 1
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	stats := make([]RouteStats, 0, len(w.routes))
+	var durations []time.Duration
+	for path, ring := range w.routes {
+		rs := RouteStats{Path: path}
+		var errors int64
+		durations = durations[:0]
+		for i := range ring {
+			if ring[i].sec < oldest || ring[i].sec > now.Unix() {
+				continue
+			}
+			rs.Requests += ring[i].requests
+			errors += ring[i].errors
+			durations = append(durations, ring[i].durations...)
+		}
+		if rs.Requests == 0 {
+			delete(w.routes, path)
+			continue
+		}
+		rs.RPS = float64(rs.Requests) / float64(w.slots)
+		rs.ErrorRate = float64(errors) / float64(rs.Requests)
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		rs.P50 = quantile(durations, 0.5)
+		rs.P90 = quantile(durations, 0.9)
+		rs.P99 = quantile(durations, 0.99)
+		stats = append(stats, rs)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Path < stats[j].Path })
+
+	return stats
+}
+
+// quantile returns the q-quantile of sorted durations
+func quantile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	return sorted[int(q*float64(len(sorted)-1)+0.5)]
+}